@@ -2,38 +2,231 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 
+	cli "github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/baggage"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/boyvinall/observability-demo/pkg/boomer"
+	"github.com/boyvinall/observability-demo/pkg/util"
 )
 
+const defaultName = "old dude"
+
 func main() {
-	ctx := context.Background()
-	address := "localhost:8080"
-	conn, err := grpc.DialContext(ctx, address, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		slog.Error("failed to dial", "error", err)
-		return
+	app := &cli.App{
+		Name:      "boomer-cli",
+		Usage:     "post requests to the boomer server",
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "address",
+				Usage: "address of the GRPC server",
+				Value: "localhost:8080",
+			},
+			&cli.BoolFlag{
+				Name:  "tls",
+				Usage: "connect with TLS, verifying the server against the system roots unless --tls-ca is set",
+			},
+			&cli.StringFlag{
+				Name:  "tls-ca",
+				Usage: "CA certificate file to verify the server, implies --tls",
+			},
+			&cli.StringFlag{
+				Name:  "tls-cert",
+				Usage: "client certificate file for mTLS, implies --tls",
+			},
+			&cli.StringFlag{
+				Name:  "tls-key",
+				Usage: "client key file for mTLS",
+			},
+			&cli.StringSliceFlag{
+				Name:  "baggage",
+				Usage: "W3C baggage member to send with each request, e.g. tenant=acme",
+			},
+			&cli.BoolFlag{
+				Name:  "debug",
+				Usage: "enable debug logging, including each GRPC call",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.Bool("debug") {
+				slog.SetLogLoggerLevel(slog.LevelDebug)
+			}
+			return nil
+		},
+		Action: withClient(boom),
+		Commands: []*cli.Command{
+			{
+				Name:      "stream",
+				Usage:     "make a request and stream the progress responses",
+				ArgsUsage: "[name]",
+				Action:    withClient(boomStream),
+			},
+			{
+				Name:      "batch",
+				Usage:     "stream a request for each name, and receive one aggregated response",
+				ArgsUsage: "[name...]",
+				Action:    withClient(boomBatch),
+			},
+			{
+				Name:      "chat",
+				Usage:     "stream a request for each name, receiving a response to each",
+				ArgsUsage: "[name...]",
+				Action:    withClient(boomChat),
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		slog.Error("failed", "error", err)
+		os.Exit(1)
 	}
-	defer conn.Close()
+}
+
+// withClient dials the GRPC server and passes a client to the action
+func withClient(action func(c *cli.Context, client boomer.BoomerClient) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		creds, err := transportCredentials(c)
+		if err != nil {
+			return err
+		}
+		conn, err := grpc.DialContext(c.Context, c.String("address"),
+			grpc.WithTransportCredentials(creds),
+			grpc.WithChainUnaryInterceptor(util.UnaryClientInterceptor(slog.Default())),
+			grpc.WithChainStreamInterceptor(util.StreamClientInterceptor(slog.Default())),
+		)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
 
-	client := boomer.NewBoomerClient(conn)
+		if members := c.StringSlice("baggage"); len(members) > 0 {
+			b, err := baggage.Parse(strings.Join(members, ","))
+			if err != nil {
+				return fmt.Errorf("invalid baggage: %w", err)
+			}
+			c.Context = metadata.AppendToOutgoingContext(c.Context, "baggage", b.String())
+		}
 
-	name := "old dude"
-	if len(os.Args) > 1 {
-		name = os.Args[1]
+		return action(c, boomer.NewBoomerClient(conn))
 	}
-	resp, err := client.Boom(ctx, &boomer.BoomRequest{
-		Name: name,
+}
+
+// transportCredentials returns TLS credentials if any of the TLS flags are set, otherwise insecure credentials
+func transportCredentials(c *cli.Context) (credentials.TransportCredentials, error) {
+	files := util.TLSConfig{
+		CertFile: c.String("tls-cert"),
+		KeyFile:  c.String("tls-key"),
+		CAFile:   c.String("tls-ca"),
+	}
+	if !c.Bool("tls") && files == (util.TLSConfig{}) {
+		return insecure.NewCredentials(), nil
+	}
+
+	config, err := util.NewClientTLSConfig(files)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// names returns the names passed as arguments, or a default
+func names(c *cli.Context) []string {
+	if c.NArg() == 0 {
+		return []string{defaultName}
+	}
+	return c.Args().Slice()
+}
+
+func boom(c *cli.Context, client boomer.BoomerClient) error {
+	resp, err := client.Boom(c.Context, &boomer.BoomRequest{
+		Name: names(c)[0],
 	})
 	if err != nil {
-		slog.Error("failed to boom", "error", err)
-		return
+		return err
 	}
 	slog.Info("response", "message", resp.Message)
+	return nil
+}
+
+func boomStream(c *cli.Context, client boomer.BoomerClient) error {
+	stream, err := client.BoomStream(c.Context, &boomer.BoomRequest{
+		Name: names(c)[0],
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		progress, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("progress", "message", progress.Message, "step", progress.Step, "total", progress.Total)
+	}
+}
+
+func boomBatch(c *cli.Context, client boomer.BoomerClient) error {
+	stream, err := client.BoomBatch(c.Context)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names(c) {
+		if err = stream.Send(&boomer.BoomRequest{Name: name}); err != nil {
+			return err
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	slog.Info("response", "count", resp.Count, "messages", resp.Messages)
+	return nil
+}
+
+func boomChat(c *cli.Context, client boomer.BoomerClient) error {
+	stream, err := client.BoomChat(c.Context)
+	if err != nil {
+		return err
+	}
+
+	// send and receive concurrently, as a real bidi client would
+	g := errgroup.Group{}
+	g.Go(func() error {
+		for _, name := range names(c) {
+			if err := stream.Send(&boomer.BoomRequest{Name: name}); err != nil {
+				return err
+			}
+		}
+		return stream.CloseSend()
+	})
+	g.Go(func() error {
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			slog.Info("response", "message", resp.Message)
+		}
+	})
+	return g.Wait()
 }
@@ -1,22 +1,193 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"google.golang.org/grpc"
+
+	"github.com/boyvinall/observability-demo/pkg/natstrace"
+	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/workqueue"
+)
+
+// Work queue modes, see the --work-queue flag
+const (
+	workQueueCore      = "core"      // workQueueCore sends requests with core NATS request/reply
+	workQueueJetStream = "jetstream" // workQueueJetStream sends requests via a durable JetStream stream
 )
 
-func setupNatsConnection(address string) (*nats.Conn, error) {
+// healthCheckInterval is how often the readiness checks update the GRPC health service
+const healthCheckInterval = 2 * time.Second
+
+// natsReady checks that the connection is connected, rather than reconnecting, draining or closed
+func natsReady(c *nats.Conn) util.ReadinessCheck {
+	return func() error {
+		if status := c.Status(); status != nats.CONNECTED {
+			return fmt.Errorf("connection is %s", status)
+		}
+		return nil
+	}
+}
+
+// setupJetStream returns a JetStream context for the connection, ensuring that the work queue stream exists
+func setupJetStream(ctx context.Context, c *nats.Conn, maxAge time.Duration) (jetstream.JetStream, error) {
+	js, err := jetstream.New(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	slog.Info("Ensuring JetStream work queue", "stream", workqueue.StreamName, "subject", workqueue.Subject, "max_age", maxAge)
+	if _, err = workqueue.EnsureStream(ctx, js, maxAge); err != nil {
+		return nil, err
+	}
+	return js, nil
+}
+
+// parseDurations parses each string with [time.ParseDuration]
+func parseDurations(values []string) ([]time.Duration, error) {
+	durations := make([]time.Duration, 0, len(values))
+	for _, v := range values {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// natsConnectionConfig holds the settings for connecting to NATS
+type natsConnectionConfig struct {
+	url           string
+	name          string
+	timeout       time.Duration // timeout bounds each connection attempt
+	retryTime     time.Duration // retryTime bounds the time spent retrying the initial connection, zero for no limit
+	user          string
+	password      string
+	token         string
+	nkeyFile      string
+	credsFile     string
+	tls           util.TLSConfig // tls enables TLS if any of the files are set
+	reconnectWait time.Duration
+	maxReconnects int
+	pingInterval  time.Duration
+}
+
+// options returns the [nats.Option] for the settings
+func (config natsConnectionConfig) options() ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name(config.name),
+		nats.Timeout(config.timeout),
+		nats.ReconnectWait(config.reconnectWait),
+		nats.MaxReconnects(config.maxReconnects),
+		nats.PingInterval(config.pingInterval),
+	}
+
+	switch {
+	case config.user != "":
+		opts = append(opts, nats.UserInfo(config.user, config.password))
+	case config.token != "":
+		opts = append(opts, nats.Token(config.token))
+	case config.nkeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(config.nkeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NATS nkey: %w", err)
+		}
+		opts = append(opts, opt)
+	case config.credsFile != "":
+		opts = append(opts, nats.UserCredentials(config.credsFile))
+	}
+
+	if config.tls != (util.TLSConfig{}) {
+		tlsConfig, err := util.NewClientTLSConfig(config.tls)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create NATS TLS config: %w", err)
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+// setupNatsConnection connects to NATS, retrying with exponential backoff until the
+// retry time has elapsed or ctx is done
+func setupNatsConnection(ctx context.Context, config natsConnectionConfig) (*nats.Conn, error) {
+	opts, err := config.options()
+	if err != nil {
+		return nil, err
+	}
+
 	var c *nats.Conn
 	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = config.retryTime
 
-	err := backoff.Retry(func() error {
+	err = backoff.RetryNotify(func() error {
 		var e error
-		slog.Info("Connecting to NATS", "address", address)
-		c, e = nats.Connect(address)
+		slog.Info("Connecting to NATS", "address", redactURLs(config.url), "name", config.name)
+		c, e = nats.Connect(config.url, opts...)
 		return e
-	}, b)
+	}, backoff.WithContext(b, ctx), func(err error, next time.Duration) {
+		slog.Warn("failed to connect to NATS", "error", err, "retry_in", next)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	return c, nil
+}
+
+// drainNatsConnection drains all subscriptions on the connection, allowing in-flight
+// messages to be processed, and then closes it. It blocks until the connection is
+// closed or ctx is done, in which case the connection is closed immediately.
+func drainNatsConnection(ctx context.Context, c *natstrace.Conn) error {
+	slog.Info("Draining NATS connection")
+	if err := c.Drain(); err != nil {
+		c.Close()
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+
+	select {
+	case <-c.Closed():
+		return nil
+	case <-ctx.Done():
+		c.Close()
+		return fmt.Errorf("timed out draining NATS connection: %w", ctx.Err())
+	}
+}
+
+// stopGRPCServer gracefully stops the server, waiting for pending RPCs to complete.
+// If they don't complete within the timeout, the server is forcibly stopped.
+func stopGRPCServer(s *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+	case <-t.C:
+		slog.Warn("timed out waiting for GRPC server to stop gracefully", "timeout", timeout)
+		s.Stop()
+	}
+}
+
+// shutdownEnvironment calls the [util.ShutdownFunc] returned by [util.SetupDefaultEnvironment],
+// flushing any buffered telemetry.
+func shutdownEnvironment(shutdown util.ShutdownFunc, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	return c, err
+	if err := shutdown(ctx); err != nil {
+		slog.Error("failed to shutdown environment", "error", err)
+	}
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is prepended to the upper-cased flag name to give the environment variable for each flag,
+// e.g. --otlp-logs can be set with BOOMER_OTLP_LOGS
+const envPrefix = "BOOMER_"
+
+// flagConfig names the YAML config file, whose keys are the names of the other flags
+const flagConfig = "config"
+
+// envVar returns the environment variable for the flag name
+func envVar(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configurable allows each flag to be set by environment variable or the config file.
+// Values given on the command line take precedence, followed by the environment and then the config file.
+func configurable(flags ...cli.Flag) []cli.Flag {
+	wrapped := make([]cli.Flag, 0, len(flags))
+	for _, f := range flags {
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewStringFlag(f))
+		case *cli.StringSliceFlag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewStringSliceFlag(f))
+		case *cli.BoolFlag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewBoolFlag(f))
+		case *cli.IntFlag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewIntFlag(f))
+		case *cli.Float64Flag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewFloat64Flag(f))
+		case *cli.DurationFlag:
+			f.EnvVars = []string{envVar(f.Name)}
+			wrapped = append(wrapped, altsrc.NewDurationFlag(f))
+		default:
+			panic(fmt.Sprintf("flag %q cannot be set from the config file", f.Names()[0]))
+		}
+	}
+	return wrapped
+}
+
+// configFile applies the values from the --config file to the app and its commands
+type configFile struct {
+	keys   []string                  // keys are the flag names that may be set in the file
+	source altsrc.InputSourceContext // source holds the file values, or nil if there is no file
+}
+
+// useConfigFile adds the --config flag to the app, and sets the Before function of the app and
+// each of its commands to apply the file values to their flags
+func useConfigFile(app *cli.App) {
+	cf := &configFile{}
+	cf.addKeys(app.Flags)
+	for _, cmd := range app.Commands {
+		cf.addKeys(cmd.Flags)
+		cmd.Before = cf.apply(cmd.Flags)
+	}
+
+	app.Flags = append(app.Flags, &cli.StringFlag{
+		Name:    flagConfig,
+		Usage:   "YAML config file, keyed by flag name",
+		EnvVars: []string{envVar(flagConfig)},
+	})
+	apply := cf.apply(app.Flags)
+	app.Before = func(c *cli.Context) error {
+		if err := cf.load(c.String(flagConfig)); err != nil {
+			return err
+		}
+		return apply(c)
+	}
+}
+
+// addKeys allows the names of the flags to be used as keys in the file
+func (cf *configFile) addKeys(flags []cli.Flag) {
+	for _, f := range flags {
+		cf.keys = append(cf.keys, f.Names()...)
+	}
+}
+
+// load reads the file, checking that every key names a flag
+func (cf *configFile) load(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	values := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	for k := range values {
+		if key := fmt.Sprint(k); !slices.Contains(cf.keys, key) {
+			return fmt.Errorf("unknown key %q in config file %q", key, path)
+		}
+	}
+
+	cf.source = altsrc.NewMapInputSource(path, values)
+	return nil
+}
+
+// apply sets any of the flags that were not set on the command line or by environment variable
+func (cf *configFile) apply(flags []cli.Flag) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if cf.source == nil {
+			return nil
+		}
+		if err := altsrc.ApplyInputSourceValues(c, cf.source, flags); err != nil {
+			return fmt.Errorf("invalid config file %q: %w", c.String(flagConfig), err)
+		}
+		return nil
+	}
+}
+
+// redacted replaces the values of flags that hold secrets, see [effectiveConfig]
+const redacted = "REDACTED"
+
+// sensitiveFlags hold secrets, so their values are redacted by [effectiveConfig]
+var sensitiveFlags = []string{"nats-password", "nats-token"}
+
+// effectiveConfig returns the value of every flag of the app and the running command, however
+// it was set, for the /debug/config endpoint. Secrets, including any in the NATS URL, are redacted.
+func effectiveConfig(c *cli.Context) map[string]any {
+	config := map[string]any{}
+	for _, flags := range [][]cli.Flag{c.App.Flags, c.Command.Flags} {
+		for _, f := range flags {
+			name := f.Names()[0]
+			switch v := c.Value(name).(type) {
+			case cli.StringSlice:
+				config[name] = v.Value()
+			case time.Duration:
+				config[name] = v.String()
+			default:
+				config[name] = v
+			}
+		}
+	}
+
+	for _, name := range sensitiveFlags {
+		if config[name] != "" {
+			config[name] = redacted
+		}
+	}
+	config["nats"] = redactURLs(c.String("nats"))
+	return config
+}
+
+// redactURLs replaces any password in the comma-separated list of URLs, as accepted by --nats.
+// A URL that cannot be parsed is replaced entirely, in case it holds a secret.
+func redactURLs(urls string) string {
+	list := strings.Split(urls, ",")
+	for i, s := range list {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			list[i] = redacted
+			continue
+		}
+		list[i] = u.Redacted()
+	}
+	return strings.Join(list, ",")
+}
+
+// choice returns the value of the flag, which must be one of the allowed values
+func choice(c *cli.Context, name string, allowed ...string) (string, error) {
+	v := c.String(name)
+	if !slices.Contains(allowed, v) {
+		return "", fmt.Errorf("invalid %s %q, expected one of: %s", name, v, strings.Join(allowed, ", "))
+	}
+	return v, nil
+}
+
+// logLevel returns the value of the --log-level flag
+func logLevel(c *cli.Context) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.String("log-level"))); err != nil {
+		return 0, fmt.Errorf("invalid log-level %q: %w", c.String("log-level"), err)
+	}
+	return level, nil
+}
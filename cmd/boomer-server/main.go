@@ -2,17 +2,40 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nats-io/nats.go"
 	cli "github.com/urfave/cli/v2"
+
+	"github.com/boyvinall/observability-demo/pkg/boomerserver"
+	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/version"
+	"github.com/boyvinall/observability-demo/pkg/worker"
+	"github.com/boyvinall/observability-demo/pkg/workqueue"
 )
 
 func main() {
 	app := &cli.App{
 		Name:  "boomer",
 		Usage: "make an explosive entrance",
-		Flags: []cli.Flag{
+		Flags: configurable(
+			&cli.StringFlag{
+				Name:  "service-version",
+				Usage: "service version applied to telemetry, defaults to the build version",
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Usage: "minimum log level: debug, info, warn or error",
+				Value: "debug",
+			},
 			&cli.StringFlag{
 				Name:  "otlp",
 				Usage: "OTLP endpoint",
@@ -23,32 +46,251 @@ func main() {
 				Usage: "NATS endpoint",
 				Value: "nats://nats:4222",
 			},
+			&cli.DurationFlag{
+				Name:  "nats-timeout",
+				Usage: "timeout for each attempt to connect to NATS",
+				Value: nats.DefaultTimeout,
+			},
+			&cli.DurationFlag{
+				Name:  "nats-connect-retry-time",
+				Usage: "maximum time to retry the initial NATS connection before exiting with an error, zero to retry forever",
+				Value: time.Minute,
+			},
+			&cli.StringFlag{
+				Name:  "nats-name",
+				Usage: "NATS connection name, shown by the server monitoring endpoints, defaults to the service name",
+			},
+			&cli.StringFlag{
+				Name:  "nats-user",
+				Usage: "NATS username, used with --nats-password",
+			},
+			&cli.StringFlag{
+				Name:  "nats-password",
+				Usage: "NATS password",
+			},
+			&cli.StringFlag{
+				Name:  "nats-token",
+				Usage: "NATS authentication token",
+			},
+			&cli.StringFlag{
+				Name:  "nats-nkey",
+				Usage: "NATS NKey seed file",
+			},
+			&cli.StringFlag{
+				Name:  "nats-creds",
+				Usage: "NATS user credentials file, holding a JWT and NKey seed",
+			},
+			&cli.StringFlag{
+				Name:  "nats-tls-ca",
+				Usage: "CA certificate file to verify the NATS server, enables TLS",
+			},
+			&cli.StringFlag{
+				Name:  "nats-tls-cert",
+				Usage: "client certificate file for NATS mTLS, enables TLS",
+			},
+			&cli.StringFlag{
+				Name:  "nats-tls-key",
+				Usage: "client key file for --nats-tls-cert",
+			},
+			&cli.DurationFlag{
+				Name:  "nats-reconnect-wait",
+				Usage: "time to wait between NATS reconnect attempts",
+				Value: nats.DefaultReconnectWait,
+			},
+			&cli.IntFlag{
+				Name:  "nats-max-reconnects",
+				Usage: "maximum number of NATS reconnect attempts before giving up, -1 for no limit",
+				Value: nats.DefaultMaxReconnect,
+			},
+			&cli.DurationFlag{
+				Name:  "nats-ping-interval",
+				Usage: "interval between pings to detect a broken NATS connection",
+				Value: nats.DefaultPingInterval,
+			},
+			&cli.StringFlag{
+				Name:  "work-queue",
+				Usage: "how requests are sent to workers: core for NATS request/reply, or jetstream for a durable work queue",
+				Value: workQueueCore,
+			},
+			&cli.DurationFlag{
+				Name:  "work-queue-max-age",
+				Usage: "discard jetstream work queue requests older than this, which should be at least the server request-timeout",
+				Value: workqueue.DefaultMaxAge,
+			},
 			&cli.StringFlag{
 				Name:  "listen-metrics",
 				Usage: "listen address for prometheus metrics endpoint",
 				Value: "0.0.0.0:2223",
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "debug-endpoints",
+				Usage: "serve /debug/pprof/, /debug/vars and /debug/config on the metrics listen address",
+			},
+			&cli.DurationFlag{
+				Name:  "shutdown-timeout",
+				Usage: "maximum time to wait for in-flight work to complete on shutdown",
+				Value: 10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-exporter",
+				Usage: "how metrics are exported: prometheus, otlp or both",
+				Value: string(util.MetricsExporterPrometheus),
+			},
+			&cli.StringFlag{
+				Name:  "otlp-metrics-protocol",
+				Usage: "protocol for the OTLP metrics exporter: grpc or http",
+				Value: util.OTLPProtocolGRPC,
+			},
+			&cli.DurationFlag{
+				Name:  "metrics-export-interval",
+				Usage: "interval between OTLP metrics exports",
+				Value: 15 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-temporality",
+				Usage: "temporality for OTLP metrics: cumulative or delta",
+				Value: util.TemporalityCumulative,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-exemplar-filter",
+				Usage: "which measurements carry trace exemplars: trace_based, always_on or always_off; defaults to $OTEL_METRICS_EXEMPLAR_FILTER or trace_based",
+			},
+			&cli.StringFlag{
+				Name:  "otlp-logs",
+				Usage: "OTLP logs endpoint, host:port for grpc or a URL for http; logs are only written to stdout if empty",
+			},
+			&cli.StringFlag{
+				Name:  "otlp-logs-protocol",
+				Usage: "protocol for the OTLP logs exporter: grpc or http",
+				Value: util.OTLPProtocolGRPC,
+			},
+			&cli.StringFlag{
+				Name:  "trace-sampler",
+				Usage: "trace sampler, e.g. parentbased_traceidratio; defaults to $OTEL_TRACES_SAMPLER or parentbased_always_on",
+			},
+			&cli.StringFlag{
+				Name:  "trace-sampler-arg",
+				Usage: "trace sampler argument, e.g. the ratio for parentbased_traceidratio",
+			},
+			&cli.StringSliceFlag{
+				Name:  "trace-sampler-rule",
+				Usage: "per-method sampling rule for new traces as method:ratio[:errors], e.g. Boom:0.01:errors; a remote parent's decision is always followed",
+			},
+			&cli.StringSliceFlag{
+				Name:  "propagators",
+				Usage: "context propagators for GRPC and NATS: tracecontext, baggage, b3, b3multi or jaeger; defaults to $OTEL_PROPAGATORS or tracecontext,baggage",
+			},
+			&cli.StringSliceFlag{
+				Name:  "log-baggage",
+				Usage: "baggage members to add as log attributes",
+				Value: cli.NewStringSlice("tenant", "user"),
+			},
+			&cli.BoolFlag{
+				Name:  "tail-sampling",
+				Usage: "only export traces that have errors, are slow, or are selected by the baseline ratio; each process decides separately, so only the baseline ratio keeps complete traces",
+			},
+			&cli.DurationFlag{
+				Name:  "tail-sampling-wait",
+				Usage: "maximum time to buffer a trace before making a tail sampling decision",
+				Value: util.DefaultTailSamplingDecisionWait,
+			},
+			&cli.DurationFlag{
+				Name:  "tail-sampling-latency",
+				Usage: "keep traces containing a span longer than this, zero disables",
+				Value: 500 * time.Millisecond,
+			},
+			&cli.Float64Flag{
+				Name:  "tail-sampling-ratio",
+				Usage: "fraction of other traces to keep when tail sampling",
+				Value: 0.1,
+			},
+			&cli.IntFlag{
+				Name:  "tail-sampling-max-traces",
+				Usage: "maximum number of traces buffered for tail sampling",
+				Value: util.DefaultTailSamplingMaxTraces,
+			},
+		),
 		Commands: []*cli.Command{
+			//--------------------------------------------------
+			//  Version
+			//--------------------------------------------------
+			{
+				Name:  "version",
+				Usage: "print the build details",
+				Action: func(c *cli.Context) error {
+					fmt.Fprintf(c.App.Writer, "%s %s\n", c.App.Name, version.Get())
+					return nil
+				},
+			},
 			//--------------------------------------------------
 			//  GRPC server
 			//--------------------------------------------------
 			{
 				Name:  "server",
 				Usage: "run the GRPC server",
-				Flags: []cli.Flag{
+				Flags: configurable(
+					&cli.StringFlag{
+						Name:  "service-name",
+						Usage: "service name applied to telemetry",
+						Value: "MyBoomerServer",
+					},
 					&cli.StringFlag{
 						Name:  "listen-grpc",
 						Usage: "listen address for GRPC server",
 						Value: "0.0.0.0:8080",
 					},
-				},
+					&cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "certificate file to serve GRPC with TLS, reloaded when it changes",
+					},
+					&cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "key file for --tls-cert",
+					},
+					&cli.StringFlag{
+						Name:  "tls-client-ca",
+						Usage: "CA certificate file to verify client certificates, which are then required (mTLS)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "log-metadata",
+						Usage: "incoming GRPC metadata keys to add as request log attributes",
+						Value: cli.NewStringSlice("x-request-id", "x-tenant"),
+					},
+					&cli.DurationFlag{
+						Name:  "request-timeout",
+						Usage: "time to wait for a worker to respond, or between progress messages when streaming",
+						Value: boomerserver.DefaultRequestTimeout,
+					},
+				),
 				Action: func(c *cli.Context) error {
-					return runServer(serverConfig{
+					env, err := envConfig(c)
+					if err != nil {
+						return err
+					}
+					workQueue, err := choice(c, "work-queue", workQueueCore, workQueueJetStream)
+					if err != nil {
+						return err
+					}
+					natsCfg, err := natsConfig(c)
+					if err != nil {
+						return err
+					}
+					return runServer(c.Context, serverConfig{
 						grpc: c.String("listen-grpc"),
-						prom: c.String("listen-metrics"),
-						nats: c.String("nats"),
-						otlp: c.String("otlp"),
+						tls: util.TLSConfig{
+							CertFile: c.String("tls-cert"),
+							KeyFile:  c.String("tls-key"),
+							CAFile:   c.String("tls-client-ca"),
+						},
+						prom:            c.String("listen-metrics"),
+						debug:           debugConfig(c),
+						nats:            natsCfg,
+						workQueue:       workQueue,
+						workQueueMaxAge: c.Duration("work-queue-max-age"),
+						env:             env,
+						shutdownTimeout: c.Duration("shutdown-timeout"),
+						requestTimeout:  c.Duration("request-timeout"),
+						logMetadataKeys: c.StringSlice("log-metadata"),
 					})
 				},
 			},
@@ -58,20 +300,225 @@ func main() {
 			{
 				Name:  "worker",
 				Usage: "run the NATS worker",
-				Flags: []cli.Flag{},
+				Flags: configurable(
+					&cli.StringFlag{
+						Name:  "service-name",
+						Usage: "service name applied to telemetry",
+						Value: "MyBoomerWorker",
+					},
+					&cli.StringFlag{
+						Name:  "queue-group",
+						Usage: "NATS queue group shared by workers, so that each request is processed once; empty delivers every request to every worker",
+						Value: worker.DefaultQueueGroup,
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "maximum number of requests processed at once for each subscription",
+						Value: worker.DefaultConcurrency,
+					},
+					&cli.IntFlag{
+						Name:  "pending-msgs",
+						Usage: "maximum number of messages buffered for each subscription while the worker is busy, -1 for no limit",
+						Value: nats.DefaultSubPendingMsgsLimit,
+					},
+					&cli.IntFlag{
+						Name:  "pending-bytes",
+						Usage: "maximum number of bytes buffered for each subscription while the worker is busy, -1 for no limit",
+						Value: nats.DefaultSubPendingBytesLimit,
+					},
+					&cli.StringFlag{
+						Name:  "jetstream-durable",
+						Usage: "name of the durable JetStream consumer, shared by all workers",
+						Value: "boomer-worker",
+					},
+					&cli.IntFlag{
+						Name:  "max-deliver",
+						Usage: "maximum number of JetStream delivery attempts for each request",
+						Value: 5,
+					},
+					&cli.StringSliceFlag{
+						Name:  "backoff",
+						Usage: "JetStream redelivery delays for successive attempts, must be fewer than --max-deliver",
+						Value: cli.NewStringSlice("1s", "5s", "15s"),
+					},
+					&cli.DurationFlag{
+						Name:  "ack-wait",
+						Usage: "time to wait for a JetStream ack before redelivering, when no backoff is set",
+						Value: 30 * time.Second,
+					},
+				),
 				Action: func(c *cli.Context) error {
-					return runWorker(workerConfig{
-						prom: c.String("listen-metrics"),
-						nats: c.String("nats"),
-						otlp: c.String("otlp"),
+					env, err := envConfig(c)
+					if err != nil {
+						return err
+					}
+					workQueue, err := choice(c, "work-queue", workQueueCore, workQueueJetStream)
+					if err != nil {
+						return err
+					}
+					natsCfg, err := natsConfig(c)
+					if err != nil {
+						return err
+					}
+					backoff, err := parseDurations(c.StringSlice("backoff"))
+					if err != nil {
+						return fmt.Errorf("invalid backoff: %w", err)
+					}
+					return runWorker(c.Context, workerConfig{
+						prom:            c.String("listen-metrics"),
+						debug:           debugConfig(c),
+						nats:            natsCfg,
+						workQueue:       workQueue,
+						workQueueMaxAge: c.Duration("work-queue-max-age"),
+						queueGroup:      c.String("queue-group"),
+						concurrency:     c.Int("concurrency"),
+						pendingMsgs:     c.Int("pending-msgs"),
+						pendingBytes:    c.Int("pending-bytes"),
+						consumer: workqueue.ConsumerConfig{
+							Durable:    c.String("jetstream-durable"),
+							AckWait:    c.Duration("ack-wait"),
+							MaxDeliver: c.Int("max-deliver"),
+							BackOff:    backoff,
+						},
+						env:             env,
+						shutdownTimeout: c.Duration("shutdown-timeout"),
 					})
 				},
 			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	useConfigFile(app)
+
+	// cancel the context on SIGINT/SIGTERM so that the commands can shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		stop()
 		slog.Error("unable to run app", "error", err)
 		os.Exit(1)
 	}
 }
+
+// envConfig returns the validated [util.Config] settings.
+// Errors name the flag, which is also the config file key, that has an invalid value.
+func envConfig(c *cli.Context) (util.Config, error) {
+	level, err := logLevel(c)
+	if err != nil {
+		return util.Config{}, err
+	}
+	exporter, err := choice(c, "metrics-exporter",
+		string(util.MetricsExporterPrometheus), string(util.MetricsExporterOTLP), string(util.MetricsExporterBoth))
+	if err != nil {
+		return util.Config{}, err
+	}
+	metricsProtocol, err := choice(c, "otlp-metrics-protocol", util.OTLPProtocolGRPC, util.OTLPProtocolHTTP)
+	if err != nil {
+		return util.Config{}, err
+	}
+	temporality, err := choice(c, "metrics-temporality", util.TemporalityCumulative, util.TemporalityDelta)
+	if err != nil {
+		return util.Config{}, err
+	}
+	logsProtocol, err := choice(c, "otlp-logs-protocol", util.OTLPProtocolGRPC, util.OTLPProtocolHTTP)
+	if err != nil {
+		return util.Config{}, err
+	}
+
+	var rules []util.SamplerRule
+	for _, s := range c.StringSlice("trace-sampler-rule") {
+		rule, err := util.ParseSamplerRule(s)
+		if err != nil {
+			return util.Config{}, fmt.Errorf("invalid trace-sampler-rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	var tailSampling *util.TailSamplingConfig
+	if c.Bool("tail-sampling") {
+		tailSampling = &util.TailSamplingConfig{
+			DecisionWait:     c.Duration("tail-sampling-wait"),
+			LatencyThreshold: c.Duration("tail-sampling-latency"),
+			BaselineRatio:    c.Float64("tail-sampling-ratio"),
+			MaxTraces:        c.Int("tail-sampling-max-traces"),
+		}
+	}
+
+	build := version.Get()
+	serviceVersion := c.String("service-version")
+	if serviceVersion == "" {
+		serviceVersion = build.Version
+	}
+
+	return util.Config{
+		ServiceName:           c.String("service-name"),
+		ServiceVersion:        serviceVersion,
+		ResourceAttributes:    build.ResourceAttributes(),
+		OTLPEndpoint:          c.String("otlp"),
+		LogLevel:              level,
+		MetricsExporter:       util.MetricsExporter(exporter),
+		MetricsProtocol:       metricsProtocol,
+		MetricsExportInterval: c.Duration("metrics-export-interval"),
+		MetricsTemporality:    temporality,
+		MetricsExemplarFilter: c.String("metrics-exemplar-filter"),
+		LogsEndpoint:          c.String("otlp-logs"),
+		LogsProtocol:          logsProtocol,
+		TraceSampler:          c.String("trace-sampler"),
+		TraceSamplerArg:       c.String("trace-sampler-arg"),
+		TraceSamplerRules:     rules,
+		TailSampling:          tailSampling,
+		Propagators:           c.StringSlice("propagators"),
+		LogBaggageKeys:        c.StringSlice("log-baggage"),
+	}, nil
+}
+
+// debugConfig returns the config served by the debug endpoints, or nil if they are disabled
+func debugConfig(c *cli.Context) map[string]any {
+	if !c.Bool("debug-endpoints") {
+		return nil
+	}
+	return effectiveConfig(c)
+}
+
+// natsConfig returns the validated NATS connection settings
+func natsConfig(c *cli.Context) (natsConnectionConfig, error) {
+	var auth []string
+	for _, name := range []string{"nats-user", "nats-token", "nats-nkey", "nats-creds"} {
+		if c.String(name) != "" {
+			auth = append(auth, name)
+		}
+	}
+	if len(auth) > 1 {
+		return natsConnectionConfig{}, fmt.Errorf("only one of nats-user, nats-token, nats-nkey or nats-creds can be set, got %s",
+			strings.Join(auth, " and "))
+	}
+	if c.String("nats-password") != "" && c.String("nats-user") == "" {
+		return natsConnectionConfig{}, errors.New("nats-password requires nats-user")
+	}
+
+	name := c.String("nats-name")
+	if name == "" {
+		name = c.String("service-name")
+	}
+
+	return natsConnectionConfig{
+		url:           c.String("nats"),
+		name:          name,
+		timeout:       c.Duration("nats-timeout"),
+		retryTime:     c.Duration("nats-connect-retry-time"),
+		user:          c.String("nats-user"),
+		password:      c.String("nats-password"),
+		token:         c.String("nats-token"),
+		nkeyFile:      c.String("nats-nkey"),
+		credsFile:     c.String("nats-creds"),
+		reconnectWait: c.Duration("nats-reconnect-wait"),
+		maxReconnects: c.Int("nats-max-reconnects"),
+		pingInterval:  c.Duration("nats-ping-interval"),
+		tls: util.TLSConfig{
+			CertFile: c.String("nats-tls-cert"),
+			KeyFile:  c.String("nats-tls-key"),
+			CAFile:   c.String("nats-tls-ca"),
+		},
+	}, nil
+}
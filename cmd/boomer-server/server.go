@@ -5,26 +5,39 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
+	pb "github.com/boyvinall/observability-demo/pkg/boomer"
 	"github.com/boyvinall/observability-demo/pkg/boomerserver"
+	"github.com/boyvinall/observability-demo/pkg/natstrace"
 	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/version"
 )
 
 type serverConfig struct {
-	grpc string
-	prom string
-	nats string
-	otlp string
+	grpc            string
+	tls             util.TLSConfig // tls enables TLS for the GRPC server if a certificate is set
+	prom            string
+	debug           map[string]any // debug is the config served by the debug endpoints, which are disabled if nil
+	nats            natsConnectionConfig
+	workQueue       string
+	workQueueMaxAge time.Duration
+	env             util.Config
+	shutdownTimeout time.Duration
+	requestTimeout  time.Duration
+	logMetadataKeys []string
 }
 
-func runServer(config serverConfig) error {
-	ctx := context.Background()
-	g := errgroup.Group{}
+func runServer(ctx context.Context, config serverConfig) error {
 
 	//--------------------------------------------------
 	//
@@ -33,16 +46,24 @@ func runServer(config serverConfig) error {
 	//
 	//--------------------------------------------------
 
-	err := util.SetupDefaultEnvironment(ctx, util.Config{
-		ServiceName:    "MyBoomerServer",
-		ServiceVersion: "0.0.0",
-		OTLPEndpoint:   config.otlp,
-		LogLevel:       slog.LevelDebug,
-	})
+	shutdown, err := util.SetupDefaultEnvironment(ctx, config.env)
 	if err != nil {
 		return fmt.Errorf("failed to setup default environment: %w", err)
 	}
-	g.Go(util.ServeMetrics(config.prom)) // Start the prometheus HTTP server
+	defer shutdownEnvironment(shutdown, config.shutdownTimeout)
+
+	if err := version.RegisterBuildInfo(otel.GetMeterProvider(), version.Get()); err != nil {
+		return err
+	}
+
+	ready := &util.Readiness{}
+	started := ready.Starting() // not ready until connected to NATS, which can take a while to retry
+	g, ctx := errgroup.WithContext(ctx)
+	serveOpts := []util.ServeOption{util.WithReadiness(ready)}
+	if config.debug != nil {
+		serveOpts = append(serveOpts, util.WithDebug(config.debug))
+	}
+	g.Go(util.ServeMetrics(ctx, config.prom, serveOpts...)) // Start the prometheus HTTP server
 
 	//--------------------------------------------------
 	//
@@ -52,33 +73,73 @@ func runServer(config serverConfig) error {
 
 	// create the GRPC server first so that services can register themselves to it
 
-	grpcServer := grpc.NewServer(
+	grpcOpts := []grpc.ServerOption{
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.ChainUnaryInterceptor(
-			util.UnaryServerInterceptor(nil),
+			util.UnaryServerInterceptor(nil, util.WithMetadataKeys(config.logMetadataKeys...)),
+		),
+		grpc.ChainStreamInterceptor(
+			util.StreamServerInterceptor(nil, util.WithMetadataKeys(config.logMetadataKeys...)),
 		),
-	)
+	}
+	if config.tls != (util.TLSConfig{}) {
+		tlsConfig, err := util.NewServerTLSConfig(config.tls)
+		if err != nil {
+			return err
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	grpcServer := grpc.NewServer(grpcOpts...)
 	reflection.Register(grpcServer)
 
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
 	// messaging
 
-	c, err := setupNatsConnection(config.nats)
+	c, err := setupNatsConnection(ctx, config.nats)
 	if err != nil {
 		return err
 	}
+	tc, err := natstrace.New(c)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("failed to instrument NATS connection: %w", err)
+	}
+
+	opts := []boomerserver.Option{
+		boomerserver.WithRequestTimeout(config.requestTimeout),
+	}
+	if config.workQueue == workQueueJetStream {
+		js, err := setupJetStream(ctx, c, config.workQueueMaxAge)
+		if err != nil {
+			c.Close()
+			return err
+		}
+		opts = append(opts, boomerserver.WithJetStream(js))
+	}
 
 	// create the server
 
-	_, err = boomerserver.New(grpcServer, c)
+	_, err = boomerserver.New(grpcServer, tc, opts...)
 	if err != nil {
+		c.Close()
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	// report the server as healthy while NATS is connected
+
+	ready.Add("nats", natsReady(c))
+	g.Go(ready.WatchGRPC(ctx, healthServer, healthCheckInterval, pb.Boomer_ServiceDesc.ServiceName))
+
 	slog.Info("Listening", "address", config.grpc)
 	lis, err := net.Listen("tcp", config.grpc)
 	if err != nil {
+		c.Close()
 		return fmt.Errorf("failed to listen: %w", err)
 	}
+	started()
 
 	// start the GRPC server
 
@@ -86,6 +147,27 @@ func runServer(config serverConfig) error {
 		return grpcServer.Serve(lis)
 	})
 
+	//--------------------------------------------------
+	//
+	//  shutdown when the context is cancelled, stopping
+	//  the GRPC server before the NATS connection that
+	//  it relies on
+	//
+	//--------------------------------------------------
+
+	g.Go(func() error {
+		<-ctx.Done()
+		slog.Info("Shutting down")
+
+		ready.Stop()
+		healthServer.Shutdown()
+		stopGRPCServer(grpcServer, config.shutdownTimeout)
+
+		drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.shutdownTimeout)
+		defer cancel()
+		return drainNatsConnection(drainCtx, tc)
+	})
+
 	//--------------------------------------------------
 	//
 	//  wait for the app to exit
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boyvinall/observability-demo/pkg/util"
+)
+
+// freeAddress returns a local address that nothing is listening on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// getReadyz polls /readyz until the metrics server is listening, returning the status and body
+func getReadyz(t *testing.T, address string) (int, string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + address + "/readyz")
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+}
+
+func TestReadyzBeforeNATSConnects(t *testing.T) {
+	nats := natsConnectionConfig{
+		url:     "nats://" + freeAddress(t),
+		name:    "test",
+		timeout: 100 * time.Millisecond,
+	}
+	env := util.Config{
+		ServiceName: "boomer-test",
+	}
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, prom string) error
+	}{
+		{
+			name: "server",
+			run: func(ctx context.Context, prom string) error {
+				return runServer(ctx, serverConfig{
+					grpc:            freeAddress(t),
+					prom:            prom,
+					nats:            nats,
+					env:             env,
+					shutdownTimeout: time.Second,
+				})
+			},
+		},
+		{
+			name: "worker",
+			run: func(ctx context.Context, prom string) error {
+				return runWorker(ctx, workerConfig{
+					prom:            prom,
+					nats:            nats,
+					env:             env,
+					shutdownTimeout: time.Second,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prom := freeAddress(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			errs := make(chan error, 1)
+			go func() {
+				errs <- tt.run(ctx, prom)
+			}()
+			defer func() {
+				cancel()
+				<-errs
+			}()
+
+			status, body := getReadyz(t, prom)
+			if status != http.StatusServiceUnavailable {
+				t.Errorf("got status %d, want %d", status, http.StatusServiceUnavailable)
+			}
+			if !strings.Contains(body, "starting") {
+				t.Errorf("got body %q, want it to say the service is starting", body)
+			}
+		})
+	}
+}
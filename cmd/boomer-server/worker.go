@@ -4,22 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/boyvinall/observability-demo/pkg/natstrace"
 	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/version"
 	"github.com/boyvinall/observability-demo/pkg/worker"
+	"github.com/boyvinall/observability-demo/pkg/workqueue"
 )
 
 type workerConfig struct {
-	prom string
-	nats string
-	otlp string
+	prom            string
+	debug           map[string]any // debug is the config served by the debug endpoints, which are disabled if nil
+	nats            natsConnectionConfig
+	workQueue       string
+	workQueueMaxAge time.Duration
+	queueGroup      string
+	concurrency     int
+	pendingMsgs     int
+	pendingBytes    int
+	consumer        workqueue.ConsumerConfig
+	env             util.Config
+	shutdownTimeout time.Duration
 }
 
-func runWorker(config workerConfig) error {
-	ctx := context.Background()
-	g := errgroup.Group{}
+func runWorker(ctx context.Context, config workerConfig) error {
 
 	//--------------------------------------------------
 	//
@@ -28,16 +40,24 @@ func runWorker(config workerConfig) error {
 	//
 	//--------------------------------------------------
 
-	err := util.SetupDefaultEnvironment(ctx, util.Config{
-		ServiceName:    "MyBoomerWorker",
-		ServiceVersion: "0.0.0",
-		OTLPEndpoint:   config.otlp,
-		LogLevel:       slog.LevelDebug,
-	})
+	shutdown, err := util.SetupDefaultEnvironment(ctx, config.env)
 	if err != nil {
 		return fmt.Errorf("failed to setup default environment: %w", err)
 	}
-	g.Go(util.ServeMetrics(config.prom)) // Start the prometheus HTTP server
+	defer shutdownEnvironment(shutdown, config.shutdownTimeout)
+
+	if err := version.RegisterBuildInfo(otel.GetMeterProvider(), version.Get()); err != nil {
+		return err
+	}
+
+	ready := &util.Readiness{}
+	started := ready.Starting() // not ready until connected to NATS, which can take a while to retry
+	g, ctx := errgroup.WithContext(ctx)
+	serveOpts := []util.ServeOption{util.WithReadiness(ready)}
+	if config.debug != nil {
+		serveOpts = append(serveOpts, util.WithDebug(config.debug))
+	}
+	g.Go(util.ServeMetrics(ctx, config.prom, serveOpts...)) // Start the prometheus HTTP server
 
 	//--------------------------------------------------
 	//
@@ -46,17 +66,69 @@ func runWorker(config workerConfig) error {
 	//--------------------------------------------------
 
 	// messaging
-	c, err := setupNatsConnection(config.nats)
+	c, err := setupNatsConnection(ctx, config.nats)
 	if err != nil {
 		return err
 	}
+	tc, err := natstrace.New(c)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("failed to instrument NATS connection: %w", err)
+	}
+
+	opts := []worker.Option{
+		worker.WithQueueGroup(config.queueGroup),
+		worker.WithConcurrency(config.concurrency),
+		worker.WithPendingLimits(config.pendingMsgs, config.pendingBytes),
+	}
+	if config.workQueue == workQueueJetStream {
+		js, err := setupJetStream(ctx, c, config.workQueueMaxAge)
+		if err != nil {
+			c.Close()
+			return err
+		}
+		cons, err := workqueue.EnsureConsumer(ctx, js, config.consumer)
+		if err != nil {
+			c.Close()
+			return err
+		}
+		opts = append(opts, worker.WithJetStreamConsumer(cons))
+	}
 
 	// create the worker
-	_, err = worker.New(c)
+	w, err := worker.New(tc, opts...)
 	if err != nil {
+		c.Close()
 		return fmt.Errorf("failed to create worker: %w", err)
 	}
 
+	// report the worker as ready while NATS is connected and it is receiving requests
+
+	ready.Add("nats", natsReady(c))
+	ready.Add("worker", w.Ready)
+	started()
+
+	//--------------------------------------------------
+	//
+	//  shutdown when the context is cancelled, draining
+	//  the worker so in-flight messages complete before
+	//  the connection they respond on is closed
+	//
+	//--------------------------------------------------
+
+	g.Go(func() error {
+		<-ctx.Done()
+		slog.Info("Shutting down")
+		ready.Stop()
+
+		drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.shutdownTimeout)
+		defer cancel()
+		if err := w.Drain(drainCtx); err != nil {
+			slog.Error("failed to drain worker", "error", err)
+		}
+		return drainNatsConnection(drainCtx, tc)
+	})
+
 	//--------------------------------------------------
 	//
 	//  wait for the app to exit
@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.31.0
-// 	protoc        v3.6.1
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
 // source: pkg/boomer/boomer.proto
 
 package boomer
@@ -114,6 +114,126 @@ func (x *BoomResponse) GetMessage() string {
 	return ""
 }
 
+// BoomProgress is streamed by BoomStream as the worker makes progress
+type BoomProgress struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Step    int32  `protobuf:"varint,2,opt,name=step,proto3" json:"step,omitempty"` // step counts from 1 up to total
+	Total   int32  `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`
+}
+
+func (x *BoomProgress) Reset() {
+	*x = BoomProgress{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_boomer_boomer_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BoomProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BoomProgress) ProtoMessage() {}
+
+func (x *BoomProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_boomer_boomer_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BoomProgress.ProtoReflect.Descriptor instead.
+func (*BoomProgress) Descriptor() ([]byte, []int) {
+	return file_pkg_boomer_boomer_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BoomProgress) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *BoomProgress) GetStep() int32 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+func (x *BoomProgress) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+// BoomBatchResponse aggregates the responses for a stream of requests
+type BoomBatchResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Messages []string `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	Count    int32    `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *BoomBatchResponse) Reset() {
+	*x = BoomBatchResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_boomer_boomer_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BoomBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BoomBatchResponse) ProtoMessage() {}
+
+func (x *BoomBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_boomer_boomer_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BoomBatchResponse.ProtoReflect.Descriptor instead.
+func (*BoomBatchResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_boomer_boomer_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BoomBatchResponse) GetMessages() []string {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *BoomBatchResponse) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
 var File_pkg_boomer_boomer_proto protoreflect.FileDescriptor
 
 var file_pkg_boomer_boomer_proto_rawDesc = []byte{
@@ -123,15 +243,37 @@ var file_pkg_boomer_boomer_proto_rawDesc = []byte{
 	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
 	0x6e, 0x61, 0x6d, 0x65, 0x22, 0x28, 0x0a, 0x0c, 0x42, 0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x73, 0x70,
 	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x32, 0x3d,
-	0x0a, 0x06, 0x42, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x12, 0x33, 0x0a, 0x04, 0x42, 0x6f, 0x6f, 0x6d,
-	0x12, 0x13, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42,
-	0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x35, 0x5a,
-	0x33, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x62, 0x6f, 0x79, 0x76,
-	0x69, 0x6e, 0x61, 0x6c, 0x6c, 0x2f, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x61, 0x62, 0x69, 0x6c,
-	0x69, 0x74, 0x79, 0x2d, 0x64, 0x65, 0x6d, 0x6f, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x62, 0x6f, 0x6f,
-	0x6d, 0x65, 0x72, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x52,
+	0x0a, 0x0c, 0x42, 0x6f, 0x6f, 0x6d, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x65, 0x73, 0x73, 0x12, 0x18,
+	0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x74, 0x65, 0x70,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x73, 0x74, 0x65, 0x70, 0x12, 0x14, 0x0a, 0x05,
+	0x74, 0x6f, 0x74, 0x61, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x74, 0x6f, 0x74,
+	0x61, 0x6c, 0x22, 0x45, 0x0a, 0x11, 0x42, 0x6f, 0x6f, 0x6d, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x32, 0xf8, 0x01, 0x0a, 0x06, 0x42, 0x6f,
+	0x6f, 0x6d, 0x65, 0x72, 0x12, 0x33, 0x0a, 0x04, 0x42, 0x6f, 0x6f, 0x6d, 0x12, 0x13, 0x2e, 0x62,
+	0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x14, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x0a, 0x42, 0x6f, 0x6f,
+	0x6d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x13, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72,
+	0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x62,
+	0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x65,
+	0x73, 0x73, 0x22, 0x00, 0x30, 0x01, 0x12, 0x3f, 0x0a, 0x09, 0x42, 0x6f, 0x6f, 0x6d, 0x42, 0x61,
+	0x74, 0x63, 0x68, 0x12, 0x13, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f,
+	0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65,
+	0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x12, 0x3b, 0x0a, 0x08, 0x42, 0x6f, 0x6f, 0x6d, 0x43,
+	0x68, 0x61, 0x74, 0x12, 0x13, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2e, 0x42, 0x6f, 0x6f,
+	0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x62, 0x6f, 0x6f, 0x6d, 0x65,
+	0x72, 0x2e, 0x42, 0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
+	0x28, 0x01, 0x30, 0x01, 0x42, 0x35, 0x5a, 0x33, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x62, 0x6f, 0x79, 0x76, 0x69, 0x6e, 0x61, 0x6c, 0x6c, 0x2f, 0x6f, 0x62, 0x73,
+	0x65, 0x72, 0x76, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x79, 0x2d, 0x64, 0x65, 0x6d, 0x6f, 0x2f,
+	0x70, 0x6b, 0x67, 0x2f, 0x62, 0x6f, 0x6f, 0x6d, 0x65, 0x72, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -146,16 +288,24 @@ func file_pkg_boomer_boomer_proto_rawDescGZIP() []byte {
 	return file_pkg_boomer_boomer_proto_rawDescData
 }
 
-var file_pkg_boomer_boomer_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_pkg_boomer_boomer_proto_goTypes = []interface{}{
-	(*BoomRequest)(nil),  // 0: boomer.BoomRequest
-	(*BoomResponse)(nil), // 1: boomer.BoomResponse
+var file_pkg_boomer_boomer_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_pkg_boomer_boomer_proto_goTypes = []any{
+	(*BoomRequest)(nil),       // 0: boomer.BoomRequest
+	(*BoomResponse)(nil),      // 1: boomer.BoomResponse
+	(*BoomProgress)(nil),      // 2: boomer.BoomProgress
+	(*BoomBatchResponse)(nil), // 3: boomer.BoomBatchResponse
 }
 var file_pkg_boomer_boomer_proto_depIdxs = []int32{
 	0, // 0: boomer.Boomer.Boom:input_type -> boomer.BoomRequest
-	1, // 1: boomer.Boomer.Boom:output_type -> boomer.BoomResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
+	0, // 1: boomer.Boomer.BoomStream:input_type -> boomer.BoomRequest
+	0, // 2: boomer.Boomer.BoomBatch:input_type -> boomer.BoomRequest
+	0, // 3: boomer.Boomer.BoomChat:input_type -> boomer.BoomRequest
+	1, // 4: boomer.Boomer.Boom:output_type -> boomer.BoomResponse
+	2, // 5: boomer.Boomer.BoomStream:output_type -> boomer.BoomProgress
+	3, // 6: boomer.Boomer.BoomBatch:output_type -> boomer.BoomBatchResponse
+	1, // 7: boomer.Boomer.BoomChat:output_type -> boomer.BoomResponse
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -167,7 +317,7 @@ func file_pkg_boomer_boomer_proto_init() {
 		return
 	}
 	if !protoimpl.UnsafeEnabled {
-		file_pkg_boomer_boomer_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+		file_pkg_boomer_boomer_proto_msgTypes[0].Exporter = func(v any, i int) any {
 			switch v := v.(*BoomRequest); i {
 			case 0:
 				return &v.state
@@ -179,7 +329,7 @@ func file_pkg_boomer_boomer_proto_init() {
 				return nil
 			}
 		}
-		file_pkg_boomer_boomer_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+		file_pkg_boomer_boomer_proto_msgTypes[1].Exporter = func(v any, i int) any {
 			switch v := v.(*BoomResponse); i {
 			case 0:
 				return &v.state
@@ -191,6 +341,30 @@ func file_pkg_boomer_boomer_proto_init() {
 				return nil
 			}
 		}
+		file_pkg_boomer_boomer_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*BoomProgress); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_boomer_boomer_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*BoomBatchResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -198,7 +372,7 @@ func file_pkg_boomer_boomer_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pkg_boomer_boomer_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
 // - protoc-gen-go-grpc v1.3.0
-// - protoc             v3.6.1
+// - protoc             (unknown)
 // source: pkg/boomer/boomer.proto
 
 package boomer
@@ -19,14 +19,24 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Boomer_Boom_FullMethodName = "/boomer.Boomer/Boom"
+	Boomer_Boom_FullMethodName       = "/boomer.Boomer/Boom"
+	Boomer_BoomStream_FullMethodName = "/boomer.Boomer/BoomStream"
+	Boomer_BoomBatch_FullMethodName  = "/boomer.Boomer/BoomBatch"
+	Boomer_BoomChat_FullMethodName   = "/boomer.Boomer/BoomChat"
 )
 
 // BoomerClient is the client API for Boomer service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type BoomerClient interface {
+	// Boom makes a single request to the worker
 	Boom(ctx context.Context, in *BoomRequest, opts ...grpc.CallOption) (*BoomResponse, error)
+	// BoomStream streams progress messages as the worker produces them
+	BoomStream(ctx context.Context, in *BoomRequest, opts ...grpc.CallOption) (Boomer_BoomStreamClient, error)
+	// BoomBatch makes a request to the worker for each name, returning a single aggregated response
+	BoomBatch(ctx context.Context, opts ...grpc.CallOption) (Boomer_BoomBatchClient, error)
+	// BoomChat makes a request to the worker for each name, responding to each as it completes
+	BoomChat(ctx context.Context, opts ...grpc.CallOption) (Boomer_BoomChatClient, error)
 }
 
 type boomerClient struct {
@@ -46,11 +56,115 @@ func (c *boomerClient) Boom(ctx context.Context, in *BoomRequest, opts ...grpc.C
 	return out, nil
 }
 
+func (c *boomerClient) BoomStream(ctx context.Context, in *BoomRequest, opts ...grpc.CallOption) (Boomer_BoomStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Boomer_ServiceDesc.Streams[0], Boomer_BoomStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &boomerBoomStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Boomer_BoomStreamClient interface {
+	Recv() (*BoomProgress, error)
+	grpc.ClientStream
+}
+
+type boomerBoomStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *boomerBoomStreamClient) Recv() (*BoomProgress, error) {
+	m := new(BoomProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *boomerClient) BoomBatch(ctx context.Context, opts ...grpc.CallOption) (Boomer_BoomBatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Boomer_ServiceDesc.Streams[1], Boomer_BoomBatch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &boomerBoomBatchClient{stream}
+	return x, nil
+}
+
+type Boomer_BoomBatchClient interface {
+	Send(*BoomRequest) error
+	CloseAndRecv() (*BoomBatchResponse, error)
+	grpc.ClientStream
+}
+
+type boomerBoomBatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *boomerBoomBatchClient) Send(m *BoomRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *boomerBoomBatchClient) CloseAndRecv() (*BoomBatchResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BoomBatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *boomerClient) BoomChat(ctx context.Context, opts ...grpc.CallOption) (Boomer_BoomChatClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Boomer_ServiceDesc.Streams[2], Boomer_BoomChat_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &boomerBoomChatClient{stream}
+	return x, nil
+}
+
+type Boomer_BoomChatClient interface {
+	Send(*BoomRequest) error
+	Recv() (*BoomResponse, error)
+	grpc.ClientStream
+}
+
+type boomerBoomChatClient struct {
+	grpc.ClientStream
+}
+
+func (x *boomerBoomChatClient) Send(m *BoomRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *boomerBoomChatClient) Recv() (*BoomResponse, error) {
+	m := new(BoomResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // BoomerServer is the server API for Boomer service.
 // All implementations must embed UnimplementedBoomerServer
 // for forward compatibility
 type BoomerServer interface {
+	// Boom makes a single request to the worker
 	Boom(context.Context, *BoomRequest) (*BoomResponse, error)
+	// BoomStream streams progress messages as the worker produces them
+	BoomStream(*BoomRequest, Boomer_BoomStreamServer) error
+	// BoomBatch makes a request to the worker for each name, returning a single aggregated response
+	BoomBatch(Boomer_BoomBatchServer) error
+	// BoomChat makes a request to the worker for each name, responding to each as it completes
+	BoomChat(Boomer_BoomChatServer) error
 	mustEmbedUnimplementedBoomerServer()
 }
 
@@ -61,6 +175,15 @@ type UnimplementedBoomerServer struct {
 func (UnimplementedBoomerServer) Boom(context.Context, *BoomRequest) (*BoomResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Boom not implemented")
 }
+func (UnimplementedBoomerServer) BoomStream(*BoomRequest, Boomer_BoomStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method BoomStream not implemented")
+}
+func (UnimplementedBoomerServer) BoomBatch(Boomer_BoomBatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method BoomBatch not implemented")
+}
+func (UnimplementedBoomerServer) BoomChat(Boomer_BoomChatServer) error {
+	return status.Errorf(codes.Unimplemented, "method BoomChat not implemented")
+}
 func (UnimplementedBoomerServer) mustEmbedUnimplementedBoomerServer() {}
 
 // UnsafeBoomerServer may be embedded to opt out of forward compatibility for this service.
@@ -92,6 +215,79 @@ func _Boomer_Boom_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Boomer_BoomStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BoomRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BoomerServer).BoomStream(m, &boomerBoomStreamServer{stream})
+}
+
+type Boomer_BoomStreamServer interface {
+	Send(*BoomProgress) error
+	grpc.ServerStream
+}
+
+type boomerBoomStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *boomerBoomStreamServer) Send(m *BoomProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Boomer_BoomBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BoomerServer).BoomBatch(&boomerBoomBatchServer{stream})
+}
+
+type Boomer_BoomBatchServer interface {
+	SendAndClose(*BoomBatchResponse) error
+	Recv() (*BoomRequest, error)
+	grpc.ServerStream
+}
+
+type boomerBoomBatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *boomerBoomBatchServer) SendAndClose(m *BoomBatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *boomerBoomBatchServer) Recv() (*BoomRequest, error) {
+	m := new(BoomRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Boomer_BoomChat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BoomerServer).BoomChat(&boomerBoomChatServer{stream})
+}
+
+type Boomer_BoomChatServer interface {
+	Send(*BoomResponse) error
+	Recv() (*BoomRequest, error)
+	grpc.ServerStream
+}
+
+type boomerBoomChatServer struct {
+	grpc.ServerStream
+}
+
+func (x *boomerBoomChatServer) Send(m *BoomResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *boomerBoomChatServer) Recv() (*BoomRequest, error) {
+	m := new(BoomRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Boomer_ServiceDesc is the grpc.ServiceDesc for Boomer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -104,6 +300,23 @@ var Boomer_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Boomer_Boom_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BoomStream",
+			Handler:       _Boomer_BoomStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "BoomBatch",
+			Handler:       _Boomer_BoomBatch_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "BoomChat",
+			Handler:       _Boomer_BoomChat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "pkg/boomer/boomer.proto",
 }
@@ -0,0 +1,103 @@
+package boomerserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/status"
+)
+
+// instrumentationName is the instrumentation scope for telemetry created by this package
+const instrumentationName = "github.com/boyvinall/observability-demo/pkg/boomerserver"
+
+// Values of the boomer.name metric attribute for names that don't start with a letter, see [nameBucket]
+const (
+	nameBucketNone  = "none"
+	nameBucketOther = "other"
+)
+
+// durationBuckets are the histogram bucket boundaries, in seconds, for request durations
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// serverMetrics are the RED (rate, errors, duration) metrics for the Boom RPC, plus the
+// duration of each NATS round-trip to a worker
+type serverMetrics struct {
+	requests     metric.Int64Counter
+	errors       metric.Int64Counter
+	duration     metric.Float64Histogram
+	natsDuration metric.Float64Histogram
+}
+
+// newServerMetrics creates the instruments using the meter
+func newServerMetrics(m metric.Meter) (*serverMetrics, error) {
+	sm := &serverMetrics{}
+
+	var err error
+	sm.requests, err = m.Int64Counter("boomer.boom.requests",
+		metric.WithDescription("Boom requests received"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	sm.errors, err = m.Int64Counter("boomer.boom.errors",
+		metric.WithDescription("Boom requests that failed, by GRPC status code"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	sm.duration, err = m.Float64Histogram("boomer.boom.duration",
+		metric.WithDescription("Duration of Boom requests, with exemplars linking to the trace"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	sm.natsDuration, err = m.Float64Histogram("boomer.nats.request.duration",
+		metric.WithDescription("Duration of the NATS round-trip to a worker for each request"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// recordBoom records a completed Boom request.
+// ctx should hold the request span, so that sampled requests are recorded as exemplars.
+func (sm *serverMetrics) recordBoom(ctx context.Context, name string, start time.Time, err error) {
+	attrs := metric.WithAttributes(attribute.String(attributeKeyName, nameBucket(name)))
+
+	sm.requests.Add(ctx, 1, attrs)
+	sm.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	if err != nil {
+		sm.errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String(attributeKeyName, nameBucket(name)),
+			semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))),
+		))
+	}
+}
+
+// recordNATS records the duration of a NATS round-trip
+func (sm *serverMetrics) recordNATS(ctx context.Context, name string, start time.Time) {
+	sm.natsDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String(attributeKeyName, nameBucket(name))))
+}
+
+// nameBucket maps a boomer name to a metric attribute value with bounded cardinality,
+// using its lowercase first letter.
+func nameBucket(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nameBucketNone
+	}
+	c := strings.ToLower(name[:1])[0]
+	if c < 'a' || c > 'z' {
+		return nameBucketOther
+	}
+	return string(c)
+}
@@ -3,56 +3,94 @@ package boomerserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
 	pb "github.com/boyvinall/observability-demo/pkg/boomer"
-	"github.com/boyvinall/observability-demo/pkg/natscarrier"
 	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/workqueue"
 )
 
 const (
 	attributeKeyName = "boomer.name"
+
+	subjectRequest = "req"        // subjectRequest receives a request and responds once
+	subjectStream  = "req.stream" // subjectStream receives a request and publishes progress to the reply subject
+
+	headerPublished = "Boomer-Published" // headerPublished holds the time a request was published, so that workers can measure queue lag
 )
 
+// DefaultRequestTimeout bounds each NATS round-trip, or the gap between progress messages, see [WithRequestTimeout]
+const DefaultRequestTimeout = 10 * time.Second
+
 // Server implements the boomer server
 type Server struct {
 	pb.UnimplementedBoomerServer
-	tracer trace.Tracer
-	foo    metric.Int64Counter
-	c      Connection
+	tracer  trace.Tracer
+	metrics *serverMetrics
+	c       Connection
+	js      jetstream.JetStream
+
+	requestTimeout time.Duration
+}
+
+// Option configures optional behaviour of the [Server]
+type Option func(*Server)
+
+// WithJetStream sends requests to workers via the durable [workqueue] stream,
+// rather than with a core NATS request. The stream must already exist, see [workqueue.EnsureStream].
+func WithJetStream(js jetstream.JetStream) Option {
+	return func(s *Server) {
+		s.js = js
+	}
+}
+
+// WithRequestTimeout sets how long to wait for a worker to respond, or between progress messages
+// when streaming, defaults to [DefaultRequestTimeout]
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.requestTimeout = timeout
+	}
 }
 
 // Connection is an interface for publishing and requesting messages.
-// It is satisfied by [nats.Conn], among others.
+// It is satisfied by [github.com/boyvinall/observability-demo/pkg/natstrace.Conn], which traces each message.
 type Connection interface {
-	Publish(subject string, msg []byte) error
-	Request(subject string, req []byte, timeout time.Duration) (resp *nats.Msg, err error)
-	RequestMsg(msg *nats.Msg, timeout time.Duration) (resp *nats.Msg, err error)
+	Publish(ctx context.Context, subject string, data []byte) error
+	PublishMsg(ctx context.Context, msg *nats.Msg) error
+	Request(ctx context.Context, subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+	RequestMsg(ctx context.Context, msg *nats.Msg, timeout time.Duration) (*nats.Msg, error)
+	PublishJetStream(ctx context.Context, js jetstream.JetStream, msg *nats.Msg) (*jetstream.PubAck, error)
+	SubscribeSync(subject string) (*nats.Subscription, error)
 }
 
 // New creates a new boomer server.
 // The server is registered with the provided [grpc.ServiceRegistrar].
-func New(r grpc.ServiceRegistrar, c Connection) (pb.BoomerServer, error) {
+func New(r grpc.ServiceRegistrar, c Connection, opts ...Option) (pb.BoomerServer, error) {
 	s := &Server{
-		tracer: otel.Tracer("boomer-server"),
-		c:      c,
+		tracer:         otel.Tracer("boomer-server"),
+		c:              c,
+		requestTimeout: DefaultRequestTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	pb.RegisterBoomerServer(r, s)
 
-	m := otel.GetMeterProvider().Meter("app_or_package_name")
-
 	var err error
-	s.foo, err = m.Int64Counter("foo",
-		metric.WithDescription("fooo"),
-		metric.WithUnit("ms"))
+	s.metrics, err = newServerMetrics(otel.GetMeterProvider().Meter(instrumentationName))
 	if err != nil {
 		return nil, err
 	}
@@ -61,39 +99,207 @@ func New(r grpc.ServiceRegistrar, c Connection) (pb.BoomerServer, error) {
 }
 
 // Boom implements the [pb.BoomerServer] GRPC interface
-func (s *Server) Boom(ctx context.Context, req *pb.BoomRequest) (*pb.BoomResponse, error) {
+func (s *Server) Boom(ctx context.Context, req *pb.BoomRequest) (resp *pb.BoomResponse, err error) {
+	start := time.Now()
+	defer func() { s.metrics.recordBoom(ctx, req.GetName(), start, err) }()
+
 	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(attribute.String(attributeKeyName, req.GetName()))
 
 	logger := util.LoggerFromContext(ctx)
 	logger.Info("boom", "boomer_name", req.GetName())
 
-	b, err := proto.Marshal(req)
+	resp, err = s.request(ctx, req)
 	if err != nil {
+		util.SpanError(span, err)
 		return nil, err
 	}
 
-	tc := otel.GetTextMapPropagator()
-	reqMsg := nats.NewMsg("req")
-	reqMsg.Data = b
-	tc.Inject(ctx, natscarrier.Header(reqMsg.Header))
+	logger = util.LoggerFromContext(ctx)
+	logger.Info("boom-child", "name", req.GetName())
+
+	span.AddEvent("tick", trace.WithAttributes(attribute.Int("pid", 1234), attribute.String("origin", "reddit")))
+	span.AddEvent("tick", trace.WithAttributes(attribute.Int("pid", 5678), attribute.String("precedes", "gen-x")))
+	return resp, nil
+}
+
+// BoomStream implements the [pb.BoomerServer] GRPC interface.
+// The request is published to the worker, and each progress message it publishes
+// to the reply subject is forwarded to the client until the final step is received.
+func (s *Server) BoomStream(req *pb.BoomRequest, stream pb.Boomer_BoomStreamServer) error {
+	ctx := stream.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String(attributeKeyName, req.GetName()))
+
+	logger := util.LoggerFromContext(ctx)
+	logger.Info("boom-stream", "boomer_name", req.GetName())
 
-	msg, err := s.c.RequestMsg(reqMsg, 10*time.Second)
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := s.c.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	reqMsg := newRequestMsg(subjectStream, b)
+	reqMsg.Reply = inbox
+	if err = s.c.PublishMsg(ctx, reqMsg); err != nil {
+		return err
+	}
+
+	for {
+		msgCtx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+		msg, err := sub.NextMsgWithContext(msgCtx)
+		cancel()
+		if err != nil {
+			util.SpanError(span, fmt.Errorf("failed to receive progress: %w", err))
+			return requestStatus(err)
+		}
+
+		var progress pb.BoomProgress
+		if err = proto.Unmarshal(msg.Data, &progress); err != nil {
+			util.SpanError(span, fmt.Errorf("failed to decode progress: %w", err))
+			return err
+		}
+		span.AddEvent("progress", trace.WithAttributes(
+			attribute.Int("step", int(progress.GetStep())),
+			attribute.Int("total", int(progress.GetTotal())),
+		))
+
+		if err = stream.Send(&progress); err != nil {
+			util.SpanError(span, fmt.Errorf("failed to send progress: %w", err))
+			return err
+		}
+		if progress.GetStep() >= progress.GetTotal() {
+			return nil
+		}
+	}
+}
+
+// BoomBatch implements the [pb.BoomerServer] GRPC interface.
+// Each request received from the client is sent to the worker, and the responses are aggregated.
+func (s *Server) BoomBatch(stream pb.Boomer_BoomBatchServer) error {
+	ctx := stream.Context()
+	logger := util.LoggerFromContext(ctx)
+
+	result := &pb.BoomBatchResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			logger.Info("boom-batch", "count", result.GetCount())
+			return stream.SendAndClose(result)
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.request(ctx, req)
+		if err != nil {
+			return err
+		}
+		result.Messages = append(result.Messages, resp.GetMessage())
+		result.Count++
+	}
+}
+
+// BoomChat implements the [pb.BoomerServer] GRPC interface.
+// Each request received from the client is sent to the worker, and the response is streamed back.
+func (s *Server) BoomChat(stream pb.Boomer_BoomChatServer) error {
+	ctx := stream.Context()
+	logger := util.LoggerFromContext(ctx)
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info("boom-chat", "boomer_name", req.GetName())
+
+		resp, err := s.request(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// request sends the request to a worker over NATS and waits for the response
+func (s *Server) request(ctx context.Context, req *pb.BoomRequest) (*pb.BoomResponse, error) {
+	b, err := proto.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
+
+	start := time.Now()
+	var msg *nats.Msg
+	if s.js != nil {
+		msg, err = s.requestJetStream(ctx, b)
+	} else {
+		msg, err = s.c.RequestMsg(ctx, newRequestMsg(subjectRequest, b), s.requestTimeout)
+	}
+	s.metrics.recordNATS(ctx, req.GetName(), start)
+	if err != nil {
+		return nil, requestStatus(err)
+	}
+
 	var resp pb.BoomResponse
 	err = proto.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode response: %v", err)
+	}
+	return &resp, nil
+}
+
+// requestStatus converts an error from a NATS request into a GRPC status error,
+// so that the client and the error metrics see a meaningful status code
+func requestStatus(err error) error {
+	switch {
+	case errors.Is(err, nats.ErrTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, nats.ErrNoResponders):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// requestJetStream publishes the request to the work queue stream, and waits for a worker
+// to publish the response to the subject given in the [workqueue.ReplyHeader]
+func (s *Server) requestJetStream(ctx context.Context, data []byte) (*nats.Msg, error) {
+	inbox := nats.NewInbox()
+	sub, err := s.c.SubscribeSync(inbox)
 	if err != nil {
 		return nil, err
 	}
+	defer sub.Unsubscribe()
 
-	s.foo.Add(ctx, 1)
+	reqMsg := newRequestMsg(workqueue.Subject, data)
+	reqMsg.Header.Set(workqueue.ReplyHeader, inbox)
 
-	logger = util.LoggerFromContext(ctx)
-	logger.Info("boom-child", "name", req.GetName())
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
 
-	span.AddEvent("tick", trace.WithAttributes(attribute.Int("pid", 1234), attribute.String("origin", "reddit")))
-	span.AddEvent("tick", trace.WithAttributes(attribute.Int("pid", 5678), attribute.String("precedes", "gen-x")))
-	return &resp, nil
+	if _, err = s.c.PublishJetStream(ctx, s.js, reqMsg); err != nil {
+		return nil, err
+	}
+	return sub.NextMsgWithContext(ctx)
+}
+
+// newRequestMsg creates a message to send to a worker, with the publish time in the headers
+func newRequestMsg(subject string, data []byte) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(headerPublished, time.Now().Format(time.RFC3339Nano))
+	return msg
 }
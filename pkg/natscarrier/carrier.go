@@ -2,44 +2,90 @@
 //
 // The carrier can be used to inject and extract trace/span IDs from a [nats.Msg] via
 // [go.opentelemetry.io/otel/propagation.TextMapPropagator].
+//
+// Unlike HTTP, [nats.Header] keys are case-sensitive and are not canonicalised, so a producer might send
+// "traceparent", "Traceparent" or "X-B3-TraceId" for a propagator expecting "x-b3-traceid".
+// The carrier looks up keys case-insensitively so that extraction works whichever format the producer used.
 package natscarrier
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Header implements the [go.opentelemetry.io/otel/propagation.TextMapCarrier] interface
-// using a [nats.Header] held in memory as a storage
+// using a [nats.Header] held in memory as a storage.
 type Header nats.Header
 
-// Get returns the value associated with the passed key
+var _ propagation.TextMapCarrier = Header{}
+
+// normalize returns the key used to compare header keys. Like [nats.Header], the carrier stores keys
+// exactly as they are given, but they are compared case-insensitively.
+func normalize(key string) string {
+	return strings.ToLower(key)
+}
+
+// matching lists the stored keys that match the passed key, with an exact match first
+// and any other case variants in sorted order
+func (h Header) matching(key string) []string {
+	var keys []string
+	if _, ok := h[key]; ok {
+		keys = append(keys, key)
+	}
+	var variants []string
+	for k := range h {
+		if k != key && normalize(k) == normalize(key) {
+			variants = append(variants, k)
+		}
+	}
+	slices.Sort(variants)
+	return append(keys, variants...)
+}
+
+// Get returns the first non-empty value associated with the passed key
 func (h Header) Get(key string) string {
-	v, found := h[key]
-	if !found {
+	values := h.Values(key)
+	if len(values) == 0 {
 		return ""
 	}
-	if len(v) == 0 {
-		return ""
+	return values[0]
+}
+
+// Values returns all the non-empty values associated with the passed key, see [Header.matching].
+// It has the signature of propagation.ValuesGetter, but that interface is only in OTEL releases newer than
+// the one we use, so the propagators do not extract from multiple values yet: they only use [Header.Get],
+// which returns the first of these.
+func (h Header) Values(key string) []string {
+	var values []string
+	for _, k := range h.matching(key) {
+		for _, v := range h[k] {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
 	}
-	return h[key][0]
+	return values
 }
 
-// Set stores the key-value pair
+// Set stores the key-value pair, replacing any values stored with a different case of the same key
 func (h Header) Set(key string, value string) {
+	for _, k := range h.matching(key) {
+		delete(h, k)
+	}
 	h[key] = []string{value}
 }
 
-// Keys lists the keys stored in this carrier
+// Keys lists the keys stored in this carrier, normalized to lower case and without duplicates
 func (h Header) Keys() []string {
-	keys := make([]string, len(h))
-	i := 0
+	keys := make([]string, 0, len(h))
 	for k := range h {
-		keys[i] = k
-		i++
+		keys = append(keys, normalize(k))
 	}
-	return keys
+	slices.Sort(keys)
+	return slices.Compact(keys)
 }
 
 // String implements the [fmt.Stringer] interface, see [Header]
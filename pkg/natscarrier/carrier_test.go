@@ -0,0 +1,112 @@
+package natscarrier
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// toggleCase swaps the case of the ASCII letters in s, leaving everything else unchanged
+func toggleCase(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case 'a' <= c && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case 'A' <= c && c <= 'Z':
+			b[i] = c - 'A' + 'a'
+		}
+	}
+	return string(b)
+}
+
+func FuzzHeader(f *testing.F) {
+	f.Add("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01", "stale")
+	f.Add("X-B3-TraceId", "0102030405060708090a0b0c0d0e0f10", "")
+	f.Add("baggage", "", "tenant=acme")
+	f.Add("", "value", "previous")
+
+	f.Fuzz(func(t *testing.T, key, value, previous string) {
+		// a producer has already stored the key with a different case
+		h := Header{toggleCase(key): []string{previous}}
+		h.Set(key, value)
+
+		var want []string
+		if value != "" {
+			want = []string{value}
+		}
+		for _, k := range []string{key, toggleCase(key), normalize(key)} {
+			if got := h.Values(k); !slices.Equal(got, want) {
+				t.Errorf("Values(%q) = %q, want %q", k, got, want)
+			}
+			if got := h.Get(k); got != value {
+				t.Errorf("Get(%q) = %q, want %q", k, got, value)
+			}
+		}
+
+		keys := h.Keys()
+		if !slices.Equal(keys, []string{normalize(key)}) {
+			t.Errorf("Keys() = %q, want %q", keys, []string{normalize(key)})
+		}
+		for _, k := range keys {
+			if got := h.Get(k); got != value {
+				t.Errorf("Get(%q) for a key from Keys() = %q, want %q", k, got, value)
+			}
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		SpanID:     trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	tests := []struct {
+		name       string
+		propagator propagation.TextMapPropagator
+		rename     map[string]string // rename maps the injected keys to the case used by another producer
+	}{
+		{
+			name:       "tracecontext",
+			propagator: propagation.TraceContext{},
+			rename:     map[string]string{"traceparent": "Traceparent"},
+		},
+		{
+			name:       "b3multi",
+			propagator: b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+			rename: map[string]string{
+				"x-b3-traceid": "X-B3-TraceId",
+				"x-b3-spanid":  "X-B3-SpanId",
+				"x-b3-sampled": "X-B3-Sampled",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Header{}
+			tt.propagator.Inject(trace.ContextWithRemoteSpanContext(context.Background(), sc), h)
+
+			for from, to := range tt.rename {
+				v, ok := h[from]
+				if !ok {
+					t.Fatalf("%q was not injected, got %v", from, h)
+				}
+				delete(h, from)
+				h[to] = v
+			}
+
+			got := trace.SpanContextFromContext(tt.propagator.Extract(context.Background(), h))
+			if !got.Equal(sc) {
+				t.Errorf("extracted %v, want %v", got, sc)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+// Package natstrace wraps a [nats.Conn] so that publishing and processing messages is traced
+// and measured following the OTEL messaging semantic conventions.
+//
+// Publishing methods start a PRODUCER span and inject its context into the message headers.
+// Subscription handlers are called within a CONSUMER span, whose parent is extracted from the
+// message headers. Application code never needs to use the [natscarrier] directly.
+//
+// The connection itself is also observed: disconnects, reconnects and asynchronous errors such as
+// slow consumers are logged and counted, alongside gauges for the connection state and traffic.
+// They are also added as events to any PRODUCER and CONSUMER spans in progress at the time.
+package natstrace
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/boyvinall/observability-demo/pkg/natscarrier"
+	"github.com/boyvinall/observability-demo/pkg/util"
+)
+
+// instrumentationName is the instrumentation scope for telemetry created by this package
+const instrumentationName = "github.com/boyvinall/observability-demo/pkg/natstrace"
+
+// Messaging operation names, used in span names and the messaging.operation.name attribute
+const (
+	operationPublish = "publish"
+	operationRequest = "request"
+	operationProcess = "process"
+)
+
+// temporaryDestination replaces the subject in span names and metrics for inbox subjects,
+// which are unique per request and would otherwise make them unbounded
+const temporaryDestination = "(temporary)"
+
+// MessagingSystemNATS is the messaging.system attribute for NATS, which has no constant in semconv
+var MessagingSystemNATS = semconv.MessagingSystemKey.String("nats")
+
+// MsgHandler processes a message within the CONSUMER span held by ctx.
+// A returned error is recorded on the span.
+type MsgHandler func(ctx context.Context, msg *nats.Msg) error
+
+// JetStreamHandler processes a JetStream message within the CONSUMER span held by ctx.
+// A returned error is recorded on the span; the handler is still responsible for acknowledging the message.
+type JetStreamHandler func(ctx context.Context, msg jetstream.Msg) error
+
+// Conn is a [nats.Conn] with traced methods for publishing and subscribing.
+// The methods that it overrides take a context, holding the parent span.
+type Conn struct {
+	*nats.Conn
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	metrics    *connMetrics
+	closed     chan struct{} // closed is closed by the closed handler, see [Conn.Closed]
+
+	mu     sync.Mutex
+	active map[trace.Span]struct{} // active holds the recording spans in progress, see [Conn.addEvent]
+}
+
+// Option configures a [Conn]
+type Option func(*options)
+
+type options struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the tracer provider, defaults to the global provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the meter provider, defaults to the global provider
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *options) {
+		o.meterProvider = mp
+	}
+}
+
+// WithPropagator sets the propagator used for message headers, defaults to the global propagator
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+// SubscribeOption configures a traced subscription
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	dispatch func(process func())
+}
+
+// WithDispatch sets how each message is processed. The process function starts the CONSUMER span and
+// calls the handler, so dispatch can run it elsewhere, e.g. in a bounded pool of goroutines.
+// By default, process is called directly from the subscription callback.
+func WithDispatch(dispatch func(process func())) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.dispatch = dispatch
+	}
+}
+
+// New wraps the connection. It sets the connection's disconnect, reconnect, closed and error handlers,
+// replacing any that were already set.
+func New(c *nats.Conn, opts ...Option) (*Conn, error) {
+	o := options{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	meter := o.meterProvider.Meter(instrumentationName)
+	metrics, err := newConnMetrics(meter)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &Conn{
+		Conn:       c,
+		tracer:     o.tracerProvider.Tracer(instrumentationName),
+		propagator: o.propagator,
+		metrics:    metrics,
+		closed:     make(chan struct{}),
+		active:     make(map[trace.Span]struct{}),
+	}
+	if err := tc.observeLifecycle(meter); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Publish publishes the data to the subject, see [nats.Conn.Publish]
+func (c *Conn) Publish(ctx context.Context, subject string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	return c.PublishMsg(ctx, msg)
+}
+
+// PublishMsg publishes the message, see [nats.Conn.PublishMsg]
+func (c *Conn) PublishMsg(ctx context.Context, msg *nats.Msg) error {
+	return c.publish(ctx, msg, operationPublish, func() error {
+		return c.Conn.PublishMsg(msg)
+	})
+}
+
+// Request sends the data to the subject and waits for a response, see [Conn.RequestMsg]
+func (c *Conn) Request(ctx context.Context, subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	return c.RequestMsg(ctx, msg, timeout)
+}
+
+// RequestMsg sends the message and waits up to the timeout for a response, or until ctx is done,
+// see [nats.Conn.RequestMsgWithContext]. The PRODUCER span includes the time spent waiting.
+func (c *Conn) RequestMsg(ctx context.Context, msg *nats.Msg, timeout time.Duration) (*nats.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var resp *nats.Msg
+	err := c.publish(ctx, msg, operationRequest, func() error {
+		var err error
+		resp, err = c.Conn.RequestMsgWithContext(ctx, msg)
+		return err
+	})
+	return resp, err
+}
+
+// Respond publishes the data to the reply subject of the request
+func (c *Conn) Respond(ctx context.Context, req *nats.Msg, data []byte) error {
+	resp := nats.NewMsg(req.Reply)
+	resp.Data = data
+	return c.RespondMsg(ctx, req, resp)
+}
+
+// RespondMsg publishes the response to the reply subject of the request
+func (c *Conn) RespondMsg(ctx context.Context, req, resp *nats.Msg) error {
+	if req.Reply == "" {
+		return nats.ErrMsgNoReply
+	}
+	resp.Subject = req.Reply
+	return c.PublishMsg(ctx, resp)
+}
+
+// PublishJetStream publishes the message to a JetStream stream, waiting for the ack
+func (c *Conn) PublishJetStream(ctx context.Context, js jetstream.JetStream, msg *nats.Msg) (*jetstream.PubAck, error) {
+	var ack *jetstream.PubAck
+	err := c.publish(ctx, msg, operationPublish, func() error {
+		var err error
+		ack, err = js.PublishMsg(ctx, msg)
+		return err
+	})
+	return ack, err
+}
+
+// Subscribe calls the handler for each message on the subject, see [nats.Conn.Subscribe]
+func (c *Conn) Subscribe(subject string, h MsgHandler, opts ...SubscribeOption) (*nats.Subscription, error) {
+	return c.QueueSubscribe(subject, "", h, opts...)
+}
+
+// QueueSubscribe calls the handler for each message on the subject that is delivered to this member
+// of the queue group, see [nats.Conn.QueueSubscribe]
+func (c *Conn) QueueSubscribe(subject, queue string, h MsgHandler, opts ...SubscribeOption) (*nats.Subscription, error) {
+	dispatch := newSubscribeOptions(opts).dispatch
+	return c.Conn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		dispatch(func() {
+			c.process(msg.Subject, msg.Header, len(msg.Data), func(ctx context.Context) error {
+				return h(ctx, msg)
+			})
+		})
+	})
+}
+
+// Consume calls the handler for each message from the JetStream consumer, see [jetstream.Consumer.Consume]
+func (c *Conn) Consume(cons jetstream.Consumer, h JetStreamHandler, opts ...SubscribeOption) (jetstream.ConsumeContext, error) {
+	dispatch := newSubscribeOptions(opts).dispatch
+	return cons.Consume(func(msg jetstream.Msg) {
+		dispatch(func() {
+			c.process(msg.Subject(), msg.Headers(), len(msg.Data()), func(ctx context.Context) error {
+				return h(ctx, msg)
+			})
+		})
+	})
+}
+
+// newSubscribeOptions applies the options over the defaults
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	o := subscribeOptions{
+		dispatch: func(process func()) { process() },
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// publish calls send within a PRODUCER span, having injected the span context into the message headers
+func (c *Conn) publish(ctx context.Context, msg *nats.Msg, operation string, send func() error) error {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+
+	dest := destinationAttributes(msg.Subject)
+	ctx, span := c.tracer.Start(ctx, operation+" "+destinationName(msg.Subject),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(spanAttributes(msg.Subject)...),
+		trace.WithAttributes(
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingOperationName(operation),
+			semconv.MessagingMessageBodySize(len(msg.Data)),
+		),
+	)
+	defer span.End()
+	defer c.track(span)()
+
+	c.propagator.Inject(ctx, natscarrier.Header(msg.Header))
+
+	start := time.Now()
+	err := send()
+	c.metrics.recordPublish(ctx, start, dest, err)
+	if err != nil {
+		util.SpanError(span, err)
+	}
+	return err
+}
+
+// process calls handle within a CONSUMER span, whose parent is extracted from the message headers
+func (c *Conn) process(subject string, header nats.Header, size int, handle func(ctx context.Context) error) {
+	ctx := c.propagator.Extract(context.Background(), natscarrier.Header(header))
+
+	dest := destinationAttributes(subject)
+	ctx, span := c.tracer.Start(ctx, operationProcess+" "+destinationName(subject),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(spanAttributes(subject)...),
+		trace.WithAttributes(
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingOperationName(operationProcess),
+			semconv.MessagingMessageBodySize(size),
+		),
+	)
+	defer span.End()
+	defer c.track(span)()
+
+	start := time.Now()
+	err := handle(ctx)
+	c.metrics.recordProcess(ctx, start, dest, err)
+	if err != nil {
+		util.SpanError(span, err)
+	}
+}
+
+// track adds the span to those that receive connection events, returning a function to remove it
+func (c *Conn) track(span trace.Span) func() {
+	if !span.IsRecording() {
+		return func() {}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active[span] = struct{}{}
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.active, span)
+	}
+}
+
+// addEvent adds the event to every span in progress, so that e.g. a request delayed by a reconnect shows why
+func (c *Conn) addEvent(name string, attrs ...attribute.KeyValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for span := range c.active {
+		span.AddEvent(name, trace.WithAttributes(attrs...))
+	}
+}
+
+// destinationName returns the subject, or [temporaryDestination] for an inbox
+func destinationName(subject string) string {
+	if strings.HasPrefix(subject, nats.InboxPrefix) {
+		return temporaryDestination
+	}
+	return subject
+}
+
+// spanAttributes returns the span attributes that identify the messaging system and subject
+func spanAttributes(subject string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingSystemNATS,
+		semconv.MessagingDestinationName(subject),
+		semconv.MessagingDestinationTemporary(strings.HasPrefix(subject, nats.InboxPrefix)),
+	}
+}
+
+// destinationAttributes returns the metric attributes that identify the messaging system and subject,
+// omitting the subject of an inbox to bound the cardinality
+func destinationAttributes(subject string) []attribute.KeyValue {
+	if strings.HasPrefix(subject, nats.InboxPrefix) {
+		return []attribute.KeyValue{
+			MessagingSystemNATS,
+			semconv.MessagingDestinationTemporary(true),
+		}
+	}
+	return []attribute.KeyValue{
+		MessagingSystemNATS,
+		semconv.MessagingDestinationName(subject),
+	}
+}
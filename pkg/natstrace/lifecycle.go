@@ -0,0 +1,160 @@
+package natstrace
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// connectionStates are reported by the nats.connection.state gauge
+var connectionStates = []nats.Status{
+	nats.DISCONNECTED,
+	nats.CONNECTED,
+	nats.CLOSED,
+	nats.RECONNECTING,
+	nats.CONNECTING,
+	nats.DRAINING_SUBS,
+	nats.DRAINING_PUBS,
+}
+
+// attributeKeyState is the attribute of the nats.connection.state gauge
+const attributeKeyState = attribute.Key("nats.connection.state")
+
+// Span events added for changes to the connection, see [Conn.addEvent]
+const (
+	eventDisconnected = "nats.disconnected"
+	eventReconnected  = "nats.reconnected"
+	eventSlowConsumer = "nats.slow_consumer"
+	eventError        = "nats.error"
+)
+
+// lifecycleMetrics record the state of the connection, rather than individual messages
+type lifecycleMetrics struct {
+	reconnects    metric.Int64Counter
+	slowConsumers metric.Int64Counter
+	asyncErrors   metric.Int64Counter
+}
+
+// observeLifecycle logs and measures changes to the connection state, and asynchronous errors such as slow consumers,
+// and adds them as events to the spans in progress, see [Conn.addEvent].
+// It replaces any handlers already set on the connection; [Conn.Closed] can be used instead of a closed handler.
+func (c *Conn) observeLifecycle(m metric.Meter) error {
+	lm := &lifecycleMetrics{}
+
+	var err error
+	lm.reconnects, err = m.Int64Counter("nats.connection.reconnects",
+		metric.WithDescription("Times the connection has been re-established"),
+		metric.WithUnit("{reconnect}"))
+	if err != nil {
+		return err
+	}
+	lm.slowConsumers, err = m.Int64Counter("nats.connection.slow_consumers",
+		metric.WithDescription("Times a subscription could not keep up and messages were dropped"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		return err
+	}
+	lm.asyncErrors, err = m.Int64Counter("nats.connection.errors",
+		metric.WithDescription("Asynchronous errors reported by the connection, other than slow consumers"),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return err
+	}
+	_, err = m.Int64ObservableGauge("nats.connection.state",
+		metric.WithDescription("Whether the connection is in each state, 1 for the current state and 0 otherwise"),
+		metric.WithInt64Callback(c.observeState))
+	if err != nil {
+		return err
+	}
+	_, err = m.Int64ObservableCounter("nats.connection.messages",
+		metric.WithDescription("Messages sent and received on the connection"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			stats := c.Stats()
+			o.Observe(int64(stats.InMsgs), metric.WithAttributes(MessagingSystemNATS, semconv.NetworkIoDirectionReceive))
+			o.Observe(int64(stats.OutMsgs), metric.WithAttributes(MessagingSystemNATS, semconv.NetworkIoDirectionTransmit))
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+	_, err = m.Int64ObservableCounter("nats.connection.io",
+		metric.WithDescription("Bytes sent and received on the connection"),
+		metric.WithUnit("By"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			stats := c.Stats()
+			o.Observe(int64(stats.InBytes), metric.WithAttributes(MessagingSystemNATS, semconv.NetworkIoDirectionReceive))
+			o.Observe(int64(stats.OutBytes), metric.WithAttributes(MessagingSystemNATS, semconv.NetworkIoDirectionTransmit))
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	c.SetDisconnectErrHandler(func(_ *nats.Conn, err error) {
+		if err == nil {
+			// the connection is being closed deliberately
+			slog.Info("NATS disconnected")
+			c.addEvent(eventDisconnected)
+			return
+		}
+		slog.Warn("NATS disconnected", "error", err)
+		c.addEvent(eventDisconnected, semconv.ExceptionMessage(err.Error()))
+	})
+	c.SetReconnectHandler(func(nc *nats.Conn) {
+		slog.Info("NATS reconnected", "address", nc.ConnectedUrlRedacted())
+		lm.reconnects.Add(context.Background(), 1, metric.WithAttributes(MessagingSystemNATS))
+		c.addEvent(eventReconnected, semconv.ServerAddress(nc.ConnectedAddr()))
+	})
+	c.SetClosedHandler(func(*nats.Conn) {
+		slog.Info("NATS connection closed")
+		close(c.closed)
+	})
+	c.SetErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+		attrs := metric.WithAttributes(MessagingSystemNATS)
+		if sub != nil {
+			slog.Error("NATS asynchronous error", "subject", sub.Subject, "error", err)
+			attrs = metric.WithAttributes(destinationAttributes(sub.Subject)...)
+		} else {
+			slog.Error("NATS asynchronous error", "error", err)
+		}
+
+		eventAttrs := []attribute.KeyValue{semconv.ExceptionMessage(err.Error())}
+		if sub != nil {
+			eventAttrs = append(eventAttrs, semconv.MessagingDestinationName(sub.Subject))
+		}
+
+		if errors.Is(err, nats.ErrSlowConsumer) {
+			lm.slowConsumers.Add(context.Background(), 1, attrs)
+			c.addEvent(eventSlowConsumer, eventAttrs...)
+			return
+		}
+		lm.asyncErrors.Add(context.Background(), 1, attrs)
+		c.addEvent(eventError, eventAttrs...)
+	})
+
+	return nil
+}
+
+// observeState reports 1 for the current state of the connection, and 0 for the others
+func (c *Conn) observeState(_ context.Context, o metric.Int64Observer) error {
+	current := c.Status()
+	for _, state := range connectionStates {
+		var v int64
+		if state == current {
+			v = 1
+		}
+		o.Observe(v, metric.WithAttributes(MessagingSystemNATS, attributeKeyState.String(state.String())))
+	}
+	return nil
+}
+
+// Closed returns a channel that is closed once the connection has been closed, e.g. after [nats.Conn.Drain] completes
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
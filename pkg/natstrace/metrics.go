@@ -0,0 +1,96 @@
+package natstrace
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Values of the error.type metric attribute, see [errorType]
+const (
+	errorTypeTimeout      = "timeout"
+	errorTypeNoResponders = "no_responders"
+	errorTypeCanceled     = "canceled"
+)
+
+// connMetrics are the messaging semantic convention metrics for a [Conn]
+type connMetrics struct {
+	published       metric.Int64Counter
+	publishDuration metric.Float64Histogram
+	processed       metric.Int64Counter
+	processDuration metric.Float64Histogram
+}
+
+// newConnMetrics creates the instruments using the meter
+func newConnMetrics(m metric.Meter) (*connMetrics, error) {
+	cm := &connMetrics{}
+
+	var err error
+	cm.published, err = m.Int64Counter(semconv.MessagingPublishMessagesName,
+		metric.WithDescription(semconv.MessagingPublishMessagesDescription),
+		metric.WithUnit(semconv.MessagingPublishMessagesUnit))
+	if err != nil {
+		return nil, err
+	}
+	cm.publishDuration, err = m.Float64Histogram(semconv.MessagingPublishDurationName,
+		metric.WithDescription(semconv.MessagingPublishDurationDescription),
+		metric.WithUnit(semconv.MessagingPublishDurationUnit))
+	if err != nil {
+		return nil, err
+	}
+	cm.processed, err = m.Int64Counter(semconv.MessagingProcessMessagesName,
+		metric.WithDescription(semconv.MessagingProcessMessagesDescription),
+		metric.WithUnit(semconv.MessagingProcessMessagesUnit))
+	if err != nil {
+		return nil, err
+	}
+	cm.processDuration, err = m.Float64Histogram(semconv.MessagingProcessDurationName,
+		metric.WithDescription(semconv.MessagingProcessDurationDescription),
+		metric.WithUnit(semconv.MessagingProcessDurationUnit))
+	if err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// recordPublish records a publish operation that began at start
+func (cm *connMetrics) recordPublish(ctx context.Context, start time.Time, dest []attribute.KeyValue, err error) {
+	attrs := metric.WithAttributes(withErrorType(dest, err)...)
+	cm.published.Add(ctx, 1, attrs)
+	cm.publishDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+}
+
+// recordProcess records a process operation that began at start
+func (cm *connMetrics) recordProcess(ctx context.Context, start time.Time, dest []attribute.KeyValue, err error) {
+	attrs := metric.WithAttributes(withErrorType(dest, err)...)
+	cm.processed.Add(ctx, 1, attrs)
+	cm.processDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+}
+
+// withErrorType adds the error.type attribute if err is not nil
+func withErrorType(attrs []attribute.KeyValue, err error) []attribute.KeyValue {
+	if err == nil {
+		return attrs
+	}
+	return append(attrs[:len(attrs):len(attrs)], semconv.ErrorTypeKey.String(errorType(err)))
+}
+
+// errorType classifies the error with a bounded set of values
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, nats.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return errorTypeTimeout
+	case errors.Is(err, nats.ErrNoResponders):
+		return errorTypeNoResponders
+	case errors.Is(err, context.Canceled):
+		return errorTypeCanceled
+	default:
+		return semconv.ErrorTypeOther.Value.AsString()
+	}
+}
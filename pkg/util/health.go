@@ -0,0 +1,121 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ReadinessCheck returns an error if a dependency means that the service cannot handle requests
+type ReadinessCheck func() error
+
+// Readiness holds the checks that decide whether the service is ready.
+// It is served on /readyz by [ServeMetrics], and can update a GRPC health server, see [Readiness.WatchGRPC].
+// The zero value is ready, with no checks.
+type Readiness struct {
+	mu       sync.Mutex
+	names    []string
+	checks   []ReadinessCheck
+	starting int
+	stopping bool
+}
+
+// Add registers a named check
+func (r *Readiness) Add(name string, check ReadinessCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, name)
+	r.checks = append(r.checks, check)
+}
+
+// Starting marks the service as not ready until the returned function is called, e.g. while it connects
+// to the dependencies that its checks are added for. This must be called before /readyz is served.
+func (r *Readiness) Starting() (started func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.starting++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.starting--
+		})
+	}
+}
+
+// Stop marks the service as not ready, regardless of the checks, e.g. once it starts shutting down
+func (r *Readiness) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopping = true
+}
+
+// Check runs the checks, returning an error naming each that failed
+func (r *Readiness) Check() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopping {
+		return errors.New("shutting down")
+	}
+	if r.starting > 0 {
+		return errors.New("starting")
+	}
+	var errs []error
+	for i, check := range r.checks {
+		if err := check(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ServeHTTP responds with 200 if the checks pass, or 503 with the errors if not
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := r.Check(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// WatchGRPC runs the checks every interval, setting the serving status of the services on the health server,
+// until ctx is done. The empty service name reports the status of the whole server.
+func (r *Readiness) WatchGRPC(ctx context.Context, hs *health.Server, interval time.Duration, services ...string) func() error {
+	return func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			status := healthpb.HealthCheckResponse_SERVING
+			if r.Check() != nil {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+			for _, service := range append([]string{""}, services...) {
+				hs.SetServingStatus(service, status)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// healthz always responds with 200 while the process is able to serve HTTP
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// NewLoggerProviderForResource creates an OTEL LoggerProvider with a default resource,
+// batching log records to the OTLP endpoint configured by [Config.LogsEndpoint] and [Config.LogsProtocol].
+// Use [NewOTLPHandler] to send [log/slog] records to it.
+func NewLoggerProviderForResource(ctx context.Context, r *resource.Resource, c Config) (*sdklog.LoggerProvider, error) {
+	var (
+		exp sdklog.Exporter
+		err error
+	)
+
+	switch c.LogsProtocol {
+	case OTLPProtocolGRPC, "":
+		exp, err = otlploggrpc.New(ctx,
+			otlploggrpc.WithEndpoint(c.LogsEndpoint),
+			otlploggrpc.WithInsecure(),
+			otlploggrpc.WithHeaders(otlpHeaders),
+		)
+	case OTLPProtocolHTTP:
+		exp, err = otlploghttp.New(ctx,
+			otlploghttp.WithEndpointURL(c.LogsEndpoint),
+			otlploghttp.WithHeaders(otlpHeaders),
+		)
+	default:
+		return nil, fmt.Errorf("unknown OTLP logs protocol %q", c.LogsProtocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exporter: %w", err)
+	}
+
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+		sdklog.WithResource(r),
+	)
+
+	return lp, nil
+}
@@ -2,27 +2,202 @@ package util
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 // loggerKey is used to store the logger in the context
 type loggerKey struct{}
 
+// InterceptorOption configures [UnaryServerInterceptor] and [StreamServerInterceptor]
+type InterceptorOption func(*interceptorConfig)
+
+// interceptorConfig holds the settings applied by [InterceptorOption]
+type interceptorConfig struct {
+	metadataKeys []string
+}
+
+// WithMetadataKeys adds the values of the listed incoming GRPC metadata keys, e.g. x-request-id,
+// as attributes on the request logger. Dashes in the key are replaced with underscores.
+func WithMetadataKeys(keys ...string) InterceptorOption {
+	return func(c *interceptorConfig) {
+		c.metadataKeys = append(c.metadataKeys, keys...)
+	}
+}
+
 // UnaryServerInterceptor returns a [grpc.UnaryServerInterceptor] that helps to make a logger
 // accessible from GRPC context, see [LoggerFromContext].
-func UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+//
+// The logger has attributes for the RPC method, peer address, user-agent and any metadata keys
+// selected with [WithMetadataKeys]. A single access log line is written when each call completes.
+// If logger is nil then [slog.Default] is used.
+func UnaryServerInterceptor(logger *slog.Logger, opts ...InterceptorOption) grpc.UnaryServerInterceptor {
+	c := newInterceptorConfig(opts)
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = SetContext(ctx, requestLogger(ctx, logger, info.FullMethod, c))
+		resp, err := handler(ctx, req)
+		logAccess(ctx, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a [grpc.StreamServerInterceptor] that helps to make a logger
+// accessible from the context of each GRPC stream, see [LoggerFromContext].
+//
+// The logger attributes and access log are the same as for [UnaryServerInterceptor],
+// with the access log line written when the stream completes.
+func StreamServerInterceptor(logger *slog.Logger, opts ...InterceptorOption) grpc.StreamServerInterceptor {
+	c := newInterceptorConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := SetContext(ss.Context(), requestLogger(ss.Context(), logger, info.FullMethod, c))
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logAccess(ctx, start, err)
+		return err
+	}
+}
+
+// newInterceptorConfig applies the options
+func newInterceptorConfig(opts []InterceptorOption) *interceptorConfig {
+	c := &interceptorConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// requestLogger returns a logger with attributes describing the incoming request
+func requestLogger(ctx context.Context, logger *slog.Logger, method string, c *interceptorConfig) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	attrs := []any{"rpc_method", method}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, "peer_address", p.Addr.String())
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ua := md.Get("user-agent"); len(ua) > 0 {
+		attrs = append(attrs, "user_agent", ua[0])
+	}
+	for _, key := range c.metadataKeys {
+		if v := md.Get(key); len(v) > 0 {
+			attrs = append(attrs, attributeName(key), strings.Join(v, ","))
+		}
+	}
+
+	return logger.With(attrs...)
+}
+
+// logAccess writes an access log line for a completed server call
+func logAccess(ctx context.Context, start time.Time, err error) {
+	attrs := []any{
+		"code", status.Code(err).String(),
+		"duration", time.Since(start),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	LoggerFromContext(ctx).Info("grpc access", attrs...)
+}
+
+// serverStream wraps a [grpc.ServerStream] to override its context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context for this stream
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor returns a [grpc.UnaryClientInterceptor] that makes the logger accessible
+// from the context of each GRPC call, and logs the outcome of the call at debug level.
+func UnaryClientInterceptor(logger *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		ctx = SetContext(ctx, logger)
-		return handler(ctx, req)
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		logClientCall(ctx, method, start, err)
+		return err
 	}
 }
 
+// StreamClientInterceptor returns a [grpc.StreamClientInterceptor] that makes the logger accessible
+// from the context of each GRPC stream, and logs the outcome of the stream at debug level.
+func StreamClientInterceptor(logger *slog.Logger) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = SetContext(ctx, logger)
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			logClientCall(ctx, method, start, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, ctx: ctx, method: method, start: start, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+// clientStream wraps a [grpc.ClientStream] to log when the stream finishes
+type clientStream struct {
+	grpc.ClientStream
+	ctx           context.Context
+	method        string
+	start         time.Time
+	serverStreams bool // serverStreams is false if the server sends a single response, e.g. client streaming
+	done          bool
+}
+
+// Context returns the context for this stream
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives a message, logging the outcome once the stream has finished.
+// If the server sends a single response, the stream has finished once it is received.
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if s.done {
+		return err
+	}
+	switch {
+	case err == nil && !s.serverStreams, errors.Is(err, io.EOF):
+		s.done = true
+		logClientCall(s.ctx, s.method, s.start, nil)
+	case err != nil:
+		s.done = true
+		logClientCall(s.ctx, s.method, s.start, err)
+	}
+	return err
+}
+
+// logClientCall logs the outcome of a client call
+func logClientCall(ctx context.Context, method string, start time.Time, err error) {
+	LoggerFromContext(ctx).Debug("grpc client call",
+		"method", method,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start),
+	)
+}
+
 // SetContext sets the provided logger as a context value, to be later retrieved using [LoggerFromContext].
 func SetContext(ctx context.Context, logger *slog.Logger) context.Context {
 	if logger == nil {
@@ -31,10 +206,33 @@ func SetContext(ctx context.Context, logger *slog.Logger) context.Context {
 	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
+// logKeyBaggagePrefix prefixes the attributes added for baggage members, see [SetLogBaggageKeys]
+const logKeyBaggagePrefix = "baggage_"
+
+// attributeName converts a header or baggage key to a log attribute name, e.g. x-request-id becomes x_request_id
+func attributeName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+// logBaggageKeys are the baggage members added as attributes by [LoggerFromContext], see [SetLogBaggageKeys]
+var logBaggageKeys atomic.Pointer[[]string]
+
+// SetLogBaggageKeys sets the baggage members, e.g. tenant or user, that [LoggerFromContext] adds as log attributes.
+// Each is prefixed with "baggage_", e.g. baggage_tenant. It is called by [SetupDefaultEnvironment] with [Config.LogBaggageKeys].
+func SetLogBaggageKeys(keys ...string) {
+	if len(keys) == 0 {
+		logBaggageKeys.Store(nil)
+		return
+	}
+	keys = slices.Clone(keys)
+	logBaggageKeys.Store(&keys)
+}
+
 // LoggerFromContext returns a [slog.Logger] from the context, with trace/span IDs set as log attributes.
-// The logger can be injected into the context using [SetContext] or [UnaryServerInterceptor].
+// The logger can be injected into the context using [SetContext], [UnaryServerInterceptor] or [StreamServerInterceptor].
 // If no [slog.Logger] is found in the context, the default logger is returned,
 // but will still have trace/span IDs set as log attributes if available.
+// Any baggage members selected by [SetLogBaggageKeys] are also added.
 func LoggerFromContext(ctx context.Context) *slog.Logger {
 	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
 	if !ok {
@@ -44,13 +242,22 @@ func LoggerFromContext(ctx context.Context) *slog.Logger {
 	// --8<-- [start:logger-from-context]
 	spanContext := trace.SpanContextFromContext(ctx)
 	if spanContext.HasTraceID() {
-		logger = logger.With("trace_id", spanContext.TraceID().String())
+		logger = logger.With(logKeyTraceID, spanContext.TraceID().String())
 	}
 	if spanContext.HasSpanID() {
-		logger = logger.With("span_id", spanContext.SpanID().String())
+		logger = logger.With(logKeySpanID, spanContext.SpanID().String())
 	}
 	// --8<-- [end:logger-from-context]
 
+	if keys := logBaggageKeys.Load(); keys != nil {
+		b := baggage.FromContext(ctx)
+		for _, key := range *keys {
+			if m := b.Member(key); m.Key() != "" {
+				logger = logger.With(logKeyBaggagePrefix+attributeName(key), m.Value())
+			}
+		}
+	}
+
 	return logger
 }
 
@@ -62,10 +269,12 @@ func LogrFromSlog(logger *slog.Logger) logr.Logger {
 	return logr.FromSlogHandler(logger.Handler())
 }
 
-// NewLoggerForResource creates a new [slog.Logger] with some attributes from the resource
-func NewLoggerForResource(r *resource.Resource, level slog.Leveler) *slog.Logger {
+// NewLoggerForResource creates a new [slog.Logger] with some attributes from the resource.
+// Logs are written to stdout, and also to any additional handlers such as [NewOTLPHandler].
+func NewLoggerForResource(r *resource.Resource, level slog.Leveler, handlers ...slog.Handler) *slog.Logger {
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	stdout := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	logger := slog.New(NewMultiHandler(append([]slog.Handler{stdout}, handlers...)...))
 
 	// --8<-- [start:new-logger-for-resource]
 	if hostName := GetResourceHostName(r); hostName != "" {
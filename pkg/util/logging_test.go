@@ -0,0 +1,121 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/boyvinall/observability-demo/pkg/boomer"
+)
+
+// fakeClientStream returns each of the errors in turn from RecvMsg
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv []error
+}
+
+func (s *fakeClientStream) RecvMsg(any) error {
+	err := s.recv[0]
+	s.recv = s.recv[1:]
+	return err
+}
+
+// streamDesc returns the descriptor of the Boomer stream
+func streamDesc(t *testing.T, name string) *grpc.StreamDesc {
+	t.Helper()
+
+	for i := range pb.Boomer_ServiceDesc.Streams {
+		if desc := &pb.Boomer_ServiceDesc.Streams[i]; desc.StreamName == name {
+			return desc
+		}
+	}
+	t.Fatalf("no stream %q", name)
+	return nil
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		recv   []error // recv are the results of each RecvMsg call made by the client
+		want   []string
+	}{
+		{
+			name:   "client streaming",
+			stream: "BoomBatch",
+			recv:   []error{nil},
+			want:   []string{"code=OK"},
+		},
+		{
+			name:   "client streaming failed",
+			stream: "BoomBatch",
+			recv:   []error{status.Error(codes.Unavailable, "no workers")},
+			want:   []string{"code=Unavailable"},
+		},
+		{
+			name:   "server streaming",
+			stream: "BoomStream",
+			recv:   []error{nil, nil, io.EOF},
+			want:   []string{"code=OK"},
+		},
+		{
+			name:   "server streaming failed",
+			stream: "BoomStream",
+			recv:   []error{nil, status.Error(codes.DeadlineExceeded, "timeout")},
+			want:   []string{"code=DeadlineExceeded"},
+		},
+		{
+			name:   "bidi streaming",
+			stream: "BoomChat",
+			recv:   []error{nil, nil, io.EOF},
+			want:   []string{"code=OK"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			desc := streamDesc(t, tt.stream)
+			method := "/" + pb.Boomer_ServiceDesc.ServiceName + "/" + tt.stream
+			streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				return &fakeClientStream{recv: tt.recv}, nil
+			}
+
+			cs, err := StreamClientInterceptor(logger)(context.Background(), desc, nil, method, streamer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range tt.recv {
+				_ = cs.RecvMsg(nil)
+			}
+
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				if !strings.Contains(line, "method="+method) {
+					t.Errorf("log line %q is missing the method", line)
+				}
+				lines = append(lines, line)
+			}
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(tt.want), buf.String())
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("log line %q does not contain %q", lines[i], want)
+				}
+			}
+		})
+	}
+}
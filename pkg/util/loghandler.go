@@ -0,0 +1,241 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys that [LoggerFromContext] uses for trace correlation.
+// [NewOTLPHandler] promotes these to the trace/span fields of the OTEL log record.
+const (
+	logKeyTraceID = "trace_id"
+	logKeySpanID  = "span_id"
+)
+
+// multiHandler is a [slog.Handler] that fans out each record to all of the wrapped handlers
+type multiHandler []slog.Handler
+
+// NewMultiHandler returns a [slog.Handler] that passes each record to all of the provided handlers.
+func NewMultiHandler(handlers ...slog.Handler) slog.Handler {
+	if len(handlers) == 1 {
+		return handlers[0]
+	}
+	return multiHandler(handlers)
+}
+
+// Enabled implements [slog.Handler], reporting whether any of the wrapped handlers are enabled
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements [slog.Handler]
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements [slog.Handler]
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup implements [slog.Handler]
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// otlpHandler is a [slog.Handler] that emits records to an OTEL [log.Logger]
+type otlpHandler struct {
+	logger  log.Logger
+	level   slog.Leveler
+	prefix  string         // prefix is prepended to attribute keys, from WithGroup
+	attrs   []log.KeyValue // attrs are added to every record, from WithAttrs
+	traceID trace.TraceID  // traceID is set from the trace_id attribute, see LoggerFromContext
+	spanID  trace.SpanID   // spanID is set from the span_id attribute, see LoggerFromContext
+}
+
+// NewOTLPHandler returns a [slog.Handler] that emits records to the provided OTEL [log.Logger].
+//
+// The trace_id and span_id attributes set by [LoggerFromContext] are not sent as regular attributes,
+// but instead populate the trace context of the log record. Groups are flattened into dotted attribute keys.
+func NewOTLPHandler(logger log.Logger, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &otlpHandler{
+		logger: logger,
+		level:  level,
+	}
+}
+
+// Enabled implements [slog.Handler]
+func (h *otlpHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements [slog.Handler]
+func (h *otlpHandler) Handle(ctx context.Context, r slog.Record) error {
+	var record log.Record
+	record.SetTimestamp(r.Time)
+	record.SetObservedTimestamp(time.Now())
+	record.SetBody(log.StringValue(r.Message))
+	record.SetSeverity(severity(r.Level))
+	record.SetSeverityText(r.Level.String())
+
+	traceID, spanID := h.traceID, h.spanID
+	kvs := make([]log.KeyValue, 0, len(h.attrs)+r.NumAttrs())
+	kvs = append(kvs, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		if h.prefix == "" && setTraceField(a, &traceID, &spanID) {
+			return true
+		}
+		kvs = appendAttr(kvs, h.prefix, a)
+		return true
+	})
+	record.AddAttributes(kvs...)
+
+	// the SDK takes the trace context of the record from ctx, so prefer any span that is
+	// already there and otherwise fall back to the IDs attached to the logger
+	if !trace.SpanContextFromContext(ctx).IsValid() && traceID.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+	}
+
+	h.logger.Emit(ctx, record)
+	return nil
+}
+
+// WithAttrs implements [slog.Handler]
+func (h *otlpHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]log.KeyValue{}, h.attrs...)
+	for _, a := range attrs {
+		if h.prefix == "" && setTraceField(a, &h2.traceID, &h2.spanID) {
+			continue
+		}
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup implements [slog.Handler]
+func (h *otlpHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// setTraceField parses the trace_id/span_id attributes, returning true if the attribute was consumed
+func setTraceField(a slog.Attr, traceID *trace.TraceID, spanID *trace.SpanID) bool {
+	switch a.Key {
+	case logKeyTraceID:
+		id, err := trace.TraceIDFromHex(a.Value.String())
+		if err != nil {
+			return false
+		}
+		*traceID = id
+		return true
+	case logKeySpanID:
+		id, err := trace.SpanIDFromHex(a.Value.String())
+		if err != nil {
+			return false
+		}
+		*spanID = id
+		return true
+	}
+	return false
+}
+
+// severity maps a [slog.Level] to a [log.Severity], such that the standard slog levels
+// map to the corresponding OTEL severities and intermediate levels are preserved
+func severity(level slog.Level) log.Severity {
+	const offset = slog.Level(log.SeverityInfo) - slog.LevelInfo
+	return log.Severity(level + offset)
+}
+
+// appendAttr converts a [slog.Attr] to [log.KeyValue] and appends it to kvs.
+// Groups are flattened into dotted keys, and empty attributes are ignored as per [slog.Handler].
+func appendAttr(kvs []log.KeyValue, prefix string, a slog.Attr) []log.KeyValue {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return kvs
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix = prefix + a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			kvs = appendAttr(kvs, prefix, ga)
+		}
+		return kvs
+	}
+
+	return append(kvs, log.KeyValue{Key: prefix + a.Key, Value: convertValue(a.Value)})
+}
+
+// convertValue converts a resolved [slog.Value] to a [log.Value]
+func convertValue(v slog.Value) log.Value {
+	switch v.Kind() {
+	case slog.KindBool:
+		return log.BoolValue(v.Bool())
+	case slog.KindDuration:
+		return log.Int64Value(v.Duration().Nanoseconds())
+	case slog.KindFloat64:
+		return log.Float64Value(v.Float64())
+	case slog.KindInt64:
+		return log.Int64Value(v.Int64())
+	case slog.KindString:
+		return log.StringValue(v.String())
+	case slog.KindTime:
+		return log.Int64Value(v.Time().UnixNano())
+	case slog.KindUint64:
+		if u := v.Uint64(); u <= math.MaxInt64 {
+			return log.Int64Value(int64(u))
+		}
+		return log.StringValue(v.String())
+	case slog.KindAny, slog.KindGroup, slog.KindLogValuer:
+		fallthrough
+	default:
+		switch x := v.Any().(type) {
+		case []byte:
+			return log.BytesValue(x)
+		case error:
+			return log.StringValue(x.Error())
+		case fmt.Stringer:
+			return log.StringValue(x.String())
+		default:
+			return log.StringValue(fmt.Sprintf("%+v", x))
+		}
+	}
+}
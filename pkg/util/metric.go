@@ -1,47 +1,279 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/sdk/resource"
 )
 
-// NewMeterProviderForResource creates a prometheus-based OTEL MeterProvider with a default resource
-func NewMeterProviderForResource(r *resource.Resource) (*metric.MeterProvider, error) {
-	// Create the prometheus exporter
+// MetricsExporter selects how metrics are made available, see [Config].
+type MetricsExporter string
+
+const (
+	MetricsExporterPrometheus MetricsExporter = "prometheus" // MetricsExporterPrometheus serves metrics for prometheus to scrape
+	MetricsExporterOTLP       MetricsExporter = "otlp"       // MetricsExporterOTLP periodically pushes metrics to an OTLP endpoint
+	MetricsExporterBoth       MetricsExporter = "both"       // MetricsExporterBoth does both of the above
+)
+
+// Protocols supported by the OTLP exporters
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+)
+
+// Temporalities supported by the OTLP metrics exporter
+const (
+	TemporalityCumulative = "cumulative"
+	TemporalityDelta      = "delta"
+)
+
+// Exemplar filters, as used by the standard OTEL_METRICS_EXEMPLAR_FILTER environment variable
+const (
+	ExemplarFilterTraceBased = "trace_based" // ExemplarFilterTraceBased records exemplars for measurements made within a sampled span
+	ExemplarFilterAlwaysOn   = "always_on"   // ExemplarFilterAlwaysOn records exemplars for all measurements
+	ExemplarFilterAlwaysOff  = "always_off"  // ExemplarFilterAlwaysOff disables exemplars
+)
+
+// Environment variables read by the metric SDK when creating instruments, see [EnableExemplars]
+const (
+	envExemplarFeature = "OTEL_GO_X_EXEMPLAR"
+	envExemplarFilter  = "OTEL_METRICS_EXEMPLAR_FILTER"
+)
+
+// EnableExemplars configures the metric SDK to attach exemplars to measurements, so that the
+// trace_id and span_id of a sampled request can be followed from a metric to the trace.
+// An empty filter uses $OTEL_METRICS_EXEMPLAR_FILTER, falling back to trace_based.
+//
+// Exemplars are still experimental in the SDK and can only be enabled through the environment,
+// so this must be called before any instruments are created.
+func EnableExemplars(filter string) error {
+	if filter == "" {
+		filter = os.Getenv(envExemplarFilter)
+	}
+	switch filter {
+	case "":
+		filter = ExemplarFilterTraceBased
+	case ExemplarFilterTraceBased, ExemplarFilterAlwaysOn, ExemplarFilterAlwaysOff:
+	default:
+		return fmt.Errorf("unknown exemplar filter %q", filter)
+	}
+
+	if err := os.Setenv(envExemplarFeature, "true"); err != nil {
+		return fmt.Errorf("failed to enable exemplars: %w", err)
+	}
+	if err := os.Setenv(envExemplarFilter, filter); err != nil {
+		return fmt.Errorf("failed to set exemplar filter: %w", err)
+	}
+	return nil
+}
+
+// NewMeterProviderForResource creates an OTEL MeterProvider with a default resource.
+// Metrics are exported via the provided readers, see [NewPrometheusReader] and [NewOTLPMetricReader].
+func NewMeterProviderForResource(r *resource.Resource, readers ...metric.Reader) (*metric.MeterProvider, error) {
+	if len(readers) == 0 {
+		return nil, errors.New("no metric readers configured")
+	}
+
+	opts := []metric.Option{
+		metric.WithResource(r),
+	}
+	for _, reader := range readers {
+		opts = append(opts, metric.WithReader(reader))
+	}
+
+	return metric.NewMeterProvider(opts...), nil
+}
+
+// NewMetricReadersForConfig creates the metric readers selected by [Config.MetricsExporter]
+func NewMetricReadersForConfig(ctx context.Context, c Config) ([]metric.Reader, error) {
+	var readers []metric.Reader
+
+	switch c.MetricsExporter {
+	case MetricsExporterPrometheus, MetricsExporterOTLP, MetricsExporterBoth:
+	case "":
+		c.MetricsExporter = MetricsExporterPrometheus
+	default:
+		return nil, fmt.Errorf("unknown metrics exporter %q", c.MetricsExporter)
+	}
+
+	if c.MetricsExporter == MetricsExporterPrometheus || c.MetricsExporter == MetricsExporterBoth {
+		reader, err := NewPrometheusReader()
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, reader)
+	}
+
+	if c.MetricsExporter == MetricsExporterOTLP || c.MetricsExporter == MetricsExporterBoth {
+		reader, err := NewOTLPMetricReader(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, reader)
+	}
+
+	return readers, nil
+}
+
+// NewPrometheusReader creates a metric reader that registers with the default prometheus registry,
+// so that metrics can be scraped from the endpoint served by [ServeMetrics].
+func NewPrometheusReader() (metric.Reader, error) {
 	// For an example with more config options, see https://docs.daocloud.io/en/insight/06UserGuide/01quickstart/otel/meter/#create-an-initialization-function-using-the-opentelemetry-sdk
-	metricExp, err := otelprom.New()
+	reader, err := otelprom.New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize prometheus exporter: %w", err)
 	}
+	return reader, nil
+}
 
-	mp := metric.NewMeterProvider(
-		metric.WithReader(metricExp),
-		metric.WithResource(r),
-	)
+// NewOTLPMetricReader creates a metric reader that periodically pushes metrics to [Config.OTLPEndpoint],
+// using [Config.MetricsProtocol], [Config.MetricsExportInterval] and [Config.MetricsTemporality].
+func NewOTLPMetricReader(ctx context.Context, c Config) (metric.Reader, error) {
+	temporality, err := temporalitySelector(c.MetricsTemporality)
+	if err != nil {
+		return nil, err
+	}
+
+	var exp metric.Exporter
+	switch c.MetricsProtocol {
+	case OTLPProtocolGRPC, "":
+		exp, err = otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpoint(c.OTLPEndpoint),
+			otlpmetricgrpc.WithInsecure(),
+			otlpmetricgrpc.WithHeaders(otlpHeaders),
+			otlpmetricgrpc.WithTemporalitySelector(temporality),
+		)
+	case OTLPProtocolHTTP:
+		exp, err = otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpoint(c.OTLPEndpoint),
+			otlpmetrichttp.WithInsecure(),
+			otlpmetrichttp.WithHeaders(otlpHeaders),
+			otlpmetrichttp.WithTemporalitySelector(temporality),
+		)
+	default:
+		return nil, fmt.Errorf("unknown OTLP metrics protocol %q", c.MetricsProtocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OTLP metrics exporter: %w", err)
+	}
+
+	var opts []metric.PeriodicReaderOption
+	if c.MetricsExportInterval > 0 {
+		opts = append(opts, metric.WithInterval(c.MetricsExportInterval))
+	}
 
-	return mp, nil
+	return metric.NewPeriodicReader(exp, opts...), nil
 }
 
-// ServeMetrics starts an HTTP server to serve prometheus metrics
-func ServeMetrics(address string) func() error {
+// temporalitySelector returns the [metric.TemporalitySelector] for the named temporality.
+// For delta, up-down counters remain cumulative since a delta of a non-monotonic sum is rarely useful.
+func temporalitySelector(name string) (metric.TemporalitySelector, error) {
+	switch name {
+	case TemporalityCumulative, "":
+		return metric.DefaultTemporalitySelector, nil
+	case TemporalityDelta:
+		return func(kind metric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case metric.InstrumentKindUpDownCounter, metric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			default:
+				return metricdata.DeltaTemporality
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown metrics temporality %q", name)
+	}
+}
+
+// metricsShutdownTimeout bounds how long [ServeMetrics] waits for in-flight scrapes to complete
+const metricsShutdownTimeout = 5 * time.Second
+
+// ServeOption configures the HTTP server started by [ServeMetrics]
+type ServeOption func(*serveOptions)
+
+type serveOptions struct {
+	readiness *Readiness
+	debug     bool
+	config    any
+}
+
+// WithReadiness serves the checks on /readyz, which otherwise always reports ready
+func WithReadiness(r *Readiness) ServeOption {
+	return func(o *serveOptions) {
+		o.readiness = r
+	}
+}
+
+// WithDebug serves the pprof profiles on /debug/pprof/, expvar variables on /debug/vars,
+// and the config as JSON on /debug/config. The config must already have any secrets redacted.
+// These expose details of the process, so should only be enabled where the port is not public.
+func WithDebug(config any) ServeOption {
+	return func(o *serveOptions) {
+		o.debug = true
+		o.config = config
+	}
+}
+
+// ServeMetrics starts an HTTP server to serve prometheus metrics, along with
+// /healthz for liveness and /readyz for readiness probes.
+// The server is shut down gracefully when ctx is done.
+func ServeMetrics(ctx context.Context, address string, opts ...ServeOption) func() error {
+	o := serveOptions{
+		readiness: &Readiness{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return func() error {
 		slog.Info("serving metrics", "address", address)
 
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+		mux.HandleFunc("/healthz", healthz)
+		mux.Handle("/readyz", o.readiness)
+		if o.debug {
+			handleDebug(mux, o.config)
+		}
 		metricServer := &http.Server{
 			Addr:              address,
 			ReadHeaderTimeout: 3 * time.Second, // fix for gosec G114
 			Handler:           mux,
 		}
-		return metricServer.ListenAndServe()
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- metricServer.ListenAndServe()
+		}()
+
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+		}
+
+		slog.Info("shutting down metrics server", "address", address)
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), metricsShutdownTimeout)
+		defer cancel()
+		if err := metricServer.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to shutdown metrics server: %w", err)
+		}
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
 	}
 }
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator names, as used by the standard OTEL_PROPAGATORS environment variable
+const (
+	PropagatorTraceContext = "tracecontext" // PropagatorTraceContext is the W3C traceparent/tracestate headers
+	PropagatorBaggage      = "baggage"      // PropagatorBaggage is the W3C baggage header
+	PropagatorB3           = "b3"           // PropagatorB3 is the zipkin b3 single header
+	PropagatorB3Multi      = "b3multi"      // PropagatorB3Multi is the zipkin X-B3-* multiple headers
+	PropagatorJaeger       = "jaeger"       // PropagatorJaeger is the jaeger uber-trace-id header
+)
+
+// envPropagators is the standard environment variable used to configure propagators, see [NewPropagatorForConfig]
+const envPropagators = "OTEL_PROPAGATORS"
+
+// NewPropagatorForConfig creates a composite propagator from the names in [Config.Propagators].
+// If none are named then the standard OTEL_PROPAGATORS environment variable is used,
+// falling back to tracecontext and baggage.
+func NewPropagatorForConfig(c Config) (propagation.TextMapPropagator, error) {
+	names := c.Propagators
+	if len(names) == 0 {
+		if env := os.Getenv(envPropagators); env != "" {
+			names = strings.Split(env, ",")
+		}
+	}
+	if len(names) == 0 {
+		names = []string{PropagatorTraceContext, PropagatorBaggage}
+	}
+
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New())
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PropagatorJaeger:
+			propagators = append(propagators, jaeger.Jaeger{})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
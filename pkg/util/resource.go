@@ -3,20 +3,23 @@ package util
 import (
 	"os"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-// NewDefaultResource creates an OTEL resource with a few useful [semconv] attributes
-func NewDefaultResource(serviceName, serviceVersion string) (*resource.Resource, error) {
+// NewDefaultResource creates an OTEL resource with a few useful [semconv] attributes, and any others passed
+func NewDefaultResource(serviceName, serviceVersion string, attrs ...attribute.KeyValue) (*resource.Resource, error) {
 	hostName := os.Getenv("HOSTNAME")
 	r, err := resource.Merge(
 		resource.Default(),
 		resource.NewWithAttributes(
 			semconv.SchemaURL,
-			semconv.HostName(hostName),
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion(serviceVersion),
+			append([]attribute.KeyValue{
+				semconv.HostName(hostName),
+				semconv.ServiceName(serviceName),
+				semconv.ServiceVersion(serviceVersion),
+			}, attrs...)...,
 		),
 	)
 
@@ -0,0 +1,260 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Sampler names, as used by the standard OTEL_TRACES_SAMPLER environment variable
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+// Standard environment variables used to configure the sampler, see [NewSamplerForConfig]
+const (
+	envTracesSampler    = "OTEL_TRACES_SAMPLER"
+	envTracesSamplerArg = "OTEL_TRACES_SAMPLER_ARG"
+)
+
+// SamplerRule overrides the sampling decision for spans of a particular RPC method.
+// The ratio only applies to spans that start a new trace. A span that continues a trace from a remote parent
+// follows the parent's sampled flag, so that a trace sampled upstream is never missing the spans from this service,
+// and local child spans always follow their parent.
+//
+// SampleErrors only exports the failing spans recorded by this process. The span is not sampled when it starts,
+// so the trace context passed on to other services, e.g. over NATS, is not sampled either, and the exported trace
+// is missing their spans. To keep complete failing traces, sample everything at the head and make the decision
+// with tail sampling where every span is seen, see [TailSamplingProcessor].
+type SamplerRule struct {
+	Method       string  // Method is matched against the span name (e.g. "boomer.Boomer/Boom") or the rpc.method attribute (e.g. "Boom")
+	Ratio        float64 // Ratio is the fraction of matching traces to sample
+	SampleErrors bool    // SampleErrors exports matching spans that end with an error status, even if not otherwise sampled
+}
+
+// ParseSamplerRule parses a [SamplerRule] from a string of the form "method:ratio[:errors]",
+// e.g. "Boom:0.01:errors" samples 1% of Boom calls, plus any that fail.
+func ParseSamplerRule(s string) (SamplerRule, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return SamplerRule{}, fmt.Errorf("invalid sampler rule %q, expected method:ratio[:errors]", s)
+	}
+
+	ratio, err := parseRatio(parts[1])
+	if err != nil {
+		return SamplerRule{}, fmt.Errorf("invalid sampler rule %q: %w", s, err)
+	}
+
+	rule := SamplerRule{
+		Method: parts[0],
+		Ratio:  ratio,
+	}
+	if len(parts) == 3 {
+		if parts[2] != "errors" {
+			return SamplerRule{}, fmt.Errorf("invalid sampler rule %q, unknown option %q", s, parts[2])
+		}
+		rule.SampleErrors = true
+	}
+
+	return rule, nil
+}
+
+// NewSamplerForConfig creates the [trace.Sampler] described by [Config.TraceSampler], [Config.TraceSamplerArg]
+// and [Config.TraceSamplerRules]. If no sampler is named then the standard OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG environment variables are used, falling back to parentbased_always_on.
+func NewSamplerForConfig(c Config) (trace.Sampler, error) {
+	name, arg := c.TraceSampler, c.TraceSamplerArg
+	if name == "" {
+		name, arg = os.Getenv(envTracesSampler), os.Getenv(envTracesSamplerArg)
+	}
+
+	sampler, err := newNamedSampler(strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(arg))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.TraceSamplerRules) == 0 {
+		return sampler, nil
+	}
+
+	rs := &ruleSampler{
+		fallback: sampler,
+	}
+	for _, rule := range c.TraceSamplerRules {
+		rs.rules = append(rs.rules, compiledSamplerRule{
+			SamplerRule: rule,
+			sampler:     trace.ParentBased(trace.TraceIDRatioBased(rule.Ratio)),
+		})
+	}
+	return rs, nil
+}
+
+// newNamedSampler returns one of the standard samplers, see [SamplerAlwaysOn] etc
+func newNamedSampler(name, arg string) (trace.Sampler, error) {
+	ratio := 1.0
+	if arg != "" && (name == SamplerTraceIDRatio || name == SamplerParentBasedTraceIDRatio) {
+		var err error
+		if ratio, err = parseRatio(arg); err != nil {
+			return nil, fmt.Errorf("invalid sampler argument for %s: %w", name, err)
+		}
+	}
+
+	switch name {
+	case SamplerAlwaysOn:
+		return trace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return trace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return trace.TraceIDRatioBased(ratio), nil
+	case SamplerParentBasedAlwaysOn, "":
+		return trace.ParentBased(trace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return trace.ParentBased(trace.NeverSample()), nil
+	case SamplerParentBasedTraceIDRatio:
+		return trace.ParentBased(trace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", name)
+	}
+}
+
+// parseRatio parses a sampling ratio between 0 and 1
+func parseRatio(s string) (float64, error) {
+	ratio, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ratio %q: %w", s, err)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("invalid ratio %q, must be between 0 and 1", s)
+	}
+	return ratio, nil
+}
+
+// compiledSamplerRule is a [SamplerRule] with its sampler, which follows a remote parent or applies the ratio to a new trace
+type compiledSamplerRule struct {
+	SamplerRule
+	sampler trace.Sampler
+}
+
+// matches reports whether the rule applies to the span being sampled
+func (r *compiledSamplerRule) matches(p trace.SamplingParameters) bool {
+	if p.Name == r.Method || strings.TrimPrefix(p.Name, "/") == r.Method {
+		return true
+	}
+	for _, a := range p.Attributes {
+		if a.Key == semconv.RPCMethodKey && a.Value.AsString() == r.Method {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleSampler applies per-method [SamplerRule]s, deferring to the fallback sampler for anything else.
+// Spans with a local parent always follow it, even if the fallback is not parent-based.
+type ruleSampler struct {
+	rules    []compiledSamplerRule
+	fallback trace.Sampler
+}
+
+// ShouldSample implements [trace.Sampler]
+func (s *ruleSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	psc := oteltrace.SpanContextFromContext(p.ParentContext)
+	if psc.IsValid() && !psc.IsRemote() {
+		// local children follow their parent, whatever the fallback sampler would decide
+		result := trace.SamplingResult{Decision: trace.Drop, Tracestate: psc.TraceState()}
+		if psc.IsSampled() {
+			result.Decision = trace.RecordAndSample
+		}
+		return result
+	}
+
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !rule.matches(p) {
+			continue
+		}
+		result := rule.sampler.ShouldSample(p)
+		if result.Decision == trace.Drop && rule.SampleErrors {
+			// record the span so that errorSampledProcessor can export it if it fails
+			result.Decision = trace.RecordOnly
+		}
+		return result
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+// Description implements [trace.Sampler]
+func (s *ruleSampler) Description() string {
+	rules := make([]string, len(s.rules))
+	for i, r := range s.rules {
+		rules[i] = fmt.Sprintf("%s:%g:%t", r.Method, r.Ratio, r.SampleErrors)
+	}
+	return fmt.Sprintf("RuleSampler{rules:[%s],fallback:%s}", strings.Join(rules, ","), s.fallback.Description())
+}
+
+// samplesErrors reports whether any rules need unsampled error spans to be exported
+func samplesErrors(s trace.Sampler) bool {
+	rs, ok := s.(*ruleSampler)
+	if !ok {
+		return false
+	}
+	for _, r := range rs.rules {
+		if r.SampleErrors {
+			return true
+		}
+	}
+	return false
+}
+
+// errorSampledProcessor forwards spans to the next [trace.SpanProcessor] if they are sampled,
+// and also if they were recorded but not sampled and ended with an error status.
+// This makes it possible to always export failed requests, see [SamplerRule.SampleErrors].
+type errorSampledProcessor struct {
+	next trace.SpanProcessor
+}
+
+// OnStart implements [trace.SpanProcessor]
+func (p *errorSampledProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+// OnEnd implements [trace.SpanProcessor]
+func (p *errorSampledProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() && s.Status().Code == codes.Error {
+		s = sampledSpan{s}
+	}
+	p.next.OnEnd(s)
+}
+
+// Shutdown implements [trace.SpanProcessor]
+func (p *errorSampledProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+// ForceFlush implements [trace.SpanProcessor]
+func (p *errorSampledProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// sampledSpan marks a recorded span as sampled, so that it will be exported
+type sampledSpan struct {
+	trace.ReadOnlySpan
+}
+
+// SpanContext returns the span context with the sampled flag set
+func (s sampledSpan) SpanContext() oteltrace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestRuleSamplerLocalChild(t *testing.T) {
+	fallbacks := []string{
+		SamplerAlwaysOn,
+		SamplerAlwaysOff,
+		SamplerTraceIDRatio,
+		SamplerParentBasedAlwaysOn,
+		SamplerParentBasedAlwaysOff,
+		SamplerParentBasedTraceIDRatio,
+	}
+	rules := []string{"boomer.Boomer/Boom:0", "boomer.Boomer/Boom:1"}
+
+	for _, fallback := range fallbacks {
+		for _, r := range rules {
+			t.Run(fallback+"/"+r, func(t *testing.T) {
+				rule, err := ParseSamplerRule(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sampler, err := NewSamplerForConfig(Config{
+					TraceSampler:      fallback,
+					TraceSamplerArg:   "0.5",
+					TraceSamplerRules: []SamplerRule{rule},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tracer := trace.NewTracerProvider(trace.WithSampler(sampler)).Tracer("test")
+				ctx, root := tracer.Start(context.Background(), "boomer.Boomer/Boom")
+				_, child := tracer.Start(ctx, "publish req")
+
+				rootSampled := root.SpanContext().IsSampled()
+				if want := rule.Ratio == 1; rootSampled != want {
+					t.Errorf("root sampled: %t, want %t", rootSampled, want)
+				}
+				if childSampled := child.SpanContext().IsSampled(); childSampled != rootSampled {
+					t.Errorf("child sampled: %t, want the parent's %t", childSampled, rootSampled)
+				}
+			})
+		}
+	}
+}
+
+func TestRuleSamplerLocalChildTraceState(t *testing.T) {
+	sampler, err := NewSamplerForConfig(Config{
+		TraceSampler:      SamplerAlwaysOn,
+		TraceSamplerRules: []SamplerRule{{Method: "Boom", Ratio: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := oteltrace.ParseTraceState("vendor=value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{0x01},
+		SpanID:     oteltrace.SpanID{0x01},
+		TraceFlags: oteltrace.FlagsSampled,
+		TraceState: ts,
+	})
+
+	result := sampler.ShouldSample(trace.SamplingParameters{
+		ParentContext: oteltrace.ContextWithSpanContext(context.Background(), parent),
+		TraceID:       parent.TraceID(),
+		Name:          "child",
+	})
+	if result.Decision != trace.RecordAndSample {
+		t.Errorf("decision %v, want %v", result.Decision, trace.RecordAndSample)
+	}
+	if got := result.Tracestate.String(); got != ts.String() {
+		t.Errorf("tracestate %q, want %q", got, ts.String())
+	}
+}
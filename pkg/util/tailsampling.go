@@ -0,0 +1,297 @@
+package util
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Defaults for [TailSamplingConfig]
+const (
+	DefaultTailSamplingDecisionWait     = 10 * time.Second
+	DefaultTailSamplingMaxTraces        = 10000
+	DefaultTailSamplingMaxSpansPerTrace = 1000
+)
+
+// Reasons for a tail sampling decision, recorded as the reason attribute on the decision metric
+const (
+	tailReasonError    = "error"
+	tailReasonLatency  = "latency"
+	tailReasonBaseline = "baseline"
+	tailReasonNone     = "none"
+)
+
+// TailSamplingConfig configures a [TailSamplingProcessor].
+// Zero values are replaced with the defaults, see [DefaultTailSamplingDecisionWait] etc.
+type TailSamplingConfig struct {
+	DecisionWait     time.Duration // DecisionWait is the maximum time to buffer a trace before deciding whether to keep it
+	LatencyThreshold time.Duration // LatencyThreshold keeps traces containing a span that lasts longer than this, zero disables
+	BaselineRatio    float64       // BaselineRatio is the fraction of remaining traces to keep
+	MaxTraces        int           // MaxTraces bounds the number of traces buffered, the oldest is decided early when full
+	MaxSpansPerTrace int           // MaxSpansPerTrace bounds the number of spans buffered per trace, extra spans are dropped
+}
+
+// TailSamplingProcessor is a [trace.SpanProcessor] that buffers ended spans per trace and only forwards
+// a trace to the next processor if it contains an error, is slow, or is selected by a baseline ratio.
+//
+// A trace is decided when its local root span ends, or once it has been buffered for the decision wait.
+// Spans that end after their trace was decided follow the same decision. The head sampler should
+// sample everything that might need to be kept, e.g. parentbased_always_on.
+//
+// Each process decides on its own, based only on the spans it has seen, so a trace that is slow or fails in
+// one service may be dropped by another and only partially exported. Only the baseline ratio is consistent
+// across processes, because it is keyed on the trace ID. Complete traces need the decision to be made in one
+// place that sees every span, such as the tail sampling processor of an OTEL Collector.
+type TailSamplingProcessor struct {
+	next     trace.SpanProcessor
+	config   TailSamplingConfig
+	baseline trace.Sampler
+
+	mu      sync.Mutex
+	traces  map[oteltrace.TraceID]*tailTrace
+	order   *list.List                 // order holds trace IDs, oldest first
+	decided map[oteltrace.TraceID]bool // decided caches recent decisions for late spans
+	recent  *list.List                 // recent holds trace IDs in decided, oldest first
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stop    sync.Once
+	stopped bool
+
+	decisions    metric.Int64Counter
+	droppedSpans metric.Int64Counter
+}
+
+// tailTrace holds the buffered spans for a single trace
+type tailTrace struct {
+	id       oteltrace.TraceID
+	spans    []trace.ReadOnlySpan
+	first    time.Time
+	hasError bool
+	slow     bool
+	element  *list.Element
+}
+
+// NewTailSamplingProcessor creates a [TailSamplingProcessor] that forwards kept traces to next.
+// Metrics about the decisions are recorded using the global meter provider.
+func NewTailSamplingProcessor(next trace.SpanProcessor, config TailSamplingConfig) (*TailSamplingProcessor, error) {
+	if config.DecisionWait <= 0 {
+		config.DecisionWait = DefaultTailSamplingDecisionWait
+	}
+	if config.MaxTraces <= 0 {
+		config.MaxTraces = DefaultTailSamplingMaxTraces
+	}
+	if config.MaxSpansPerTrace <= 0 {
+		config.MaxSpansPerTrace = DefaultTailSamplingMaxSpansPerTrace
+	}
+	if config.BaselineRatio < 0 || config.BaselineRatio > 1 {
+		return nil, errors.New("tail sampling baseline ratio must be between 0 and 1")
+	}
+
+	p := &TailSamplingProcessor{
+		next:     next,
+		config:   config,
+		baseline: trace.TraceIDRatioBased(config.BaselineRatio),
+		traces:   make(map[oteltrace.TraceID]*tailTrace),
+		order:    list.New(),
+		decided:  make(map[oteltrace.TraceID]bool),
+		recent:   list.New(),
+		done:     make(chan struct{}),
+	}
+
+	m := otel.GetMeterProvider().Meter(instrumentationName)
+
+	var err error
+	p.decisions, err = m.Int64Counter("tail_sampling.traces",
+		metric.WithDescription("Traces decided by the tail sampling processor, by decision and reason"),
+		metric.WithUnit("{trace}"))
+	if err != nil {
+		return nil, err
+	}
+	p.droppedSpans, err = m.Int64Counter("tail_sampling.spans.dropped",
+		metric.WithDescription("Spans dropped by the tail sampling processor because a trace exceeded the span limit"),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.Int64ObservableGauge("tail_sampling.traces.buffered",
+		metric.WithDescription("Traces currently buffered by the tail sampling processor"),
+		metric.WithUnit("{trace}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			o.Observe(int64(len(p.traces)))
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p, nil
+}
+
+// OnStart implements [trace.SpanProcessor]
+func (p *TailSamplingProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+// OnEnd implements [trace.SpanProcessor]
+func (p *TailSamplingProcessor) OnEnd(s trace.ReadOnlySpan) {
+	var forward []trace.ReadOnlySpan
+
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	id := s.SpanContext().TraceID()
+
+	// late spans follow the decision already made for their trace
+	if keep, ok := p.decided[id]; ok {
+		p.mu.Unlock()
+		if keep {
+			p.next.OnEnd(s)
+		}
+		return
+	}
+
+	t, ok := p.traces[id]
+	if !ok {
+		if len(p.traces) >= p.config.MaxTraces {
+			forward = p.decideLocked(p.traces[p.order.Front().Value.(oteltrace.TraceID)])
+		}
+		t = &tailTrace{id: id, first: time.Now()}
+		t.element = p.order.PushBack(id)
+		p.traces[id] = t
+	}
+
+	if len(t.spans) < p.config.MaxSpansPerTrace {
+		t.spans = append(t.spans, s)
+	} else {
+		p.droppedSpans.Add(context.Background(), 1)
+	}
+	if s.Status().Code == codes.Error {
+		t.hasError = true
+	}
+	if p.config.LatencyThreshold > 0 && s.EndTime().Sub(s.StartTime()) > p.config.LatencyThreshold {
+		t.slow = true
+	}
+
+	// the trace is complete, as far as this process is concerned, once the local root span ends
+	if parent := s.Parent(); !parent.IsValid() || parent.IsRemote() {
+		forward = append(forward, p.decideLocked(t)...)
+	}
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(span)
+	}
+}
+
+// decideLocked removes the trace from the buffer, records the decision and returns any spans to forward.
+// It must be called with p.mu held.
+func (p *TailSamplingProcessor) decideLocked(t *tailTrace) []trace.ReadOnlySpan {
+	delete(p.traces, t.id)
+	p.order.Remove(t.element)
+
+	reason := tailReasonNone
+	switch {
+	case t.hasError:
+		reason = tailReasonError
+	case t.slow:
+		reason = tailReasonLatency
+	case p.baseline.ShouldSample(trace.SamplingParameters{TraceID: t.id}).Decision == trace.RecordAndSample:
+		reason = tailReasonBaseline
+	}
+	keep := reason != tailReasonNone
+
+	p.decided[t.id] = keep
+	p.recent.PushBack(t.id)
+	for p.recent.Len() > p.config.MaxTraces {
+		delete(p.decided, p.recent.Remove(p.recent.Front()).(oteltrace.TraceID))
+	}
+
+	decision := "dropped"
+	if keep {
+		decision = "kept"
+	}
+	p.decisions.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("decision", decision),
+		attribute.String("reason", reason),
+	))
+
+	if !keep {
+		return nil
+	}
+	return t.spans
+}
+
+// run periodically decides any traces that have been buffered for longer than the decision wait
+func (p *TailSamplingProcessor) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.DecisionWait / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.decideExpired(time.Now().Add(-p.config.DecisionWait))
+		}
+	}
+}
+
+// decideExpired decides all traces first buffered before the cutoff, forwarding those that are kept
+func (p *TailSamplingProcessor) decideExpired(cutoff time.Time) {
+	var forward []trace.ReadOnlySpan
+
+	p.mu.Lock()
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		t := p.traces[e.Value.(oteltrace.TraceID)]
+		if t.first.After(cutoff) {
+			break
+		}
+		forward = append(forward, p.decideLocked(t)...)
+	}
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(span)
+	}
+}
+
+// Shutdown implements [trace.SpanProcessor], deciding all buffered traces before shutting down the next processor
+func (p *TailSamplingProcessor) Shutdown(ctx context.Context) error {
+	var err error
+	p.stop.Do(func() {
+		close(p.done)
+		p.wg.Wait()
+		p.decideExpired(time.Now())
+
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+
+		err = p.next.Shutdown(ctx)
+	})
+	return err
+}
+
+// ForceFlush implements [trace.SpanProcessor], deciding all buffered traces before flushing the next processor
+func (p *TailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	p.decideExpired(time.Now())
+	return p.next.ForceFlush(ctx)
+}
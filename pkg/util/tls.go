@@ -0,0 +1,162 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig names the PEM files used by [NewServerTLSConfig] and [NewClientTLSConfig]
+type TLSConfig struct {
+	CertFile string // CertFile is the certificate chain presented to the peer
+	KeyFile  string // KeyFile is the private key for the certificate
+	CAFile   string // CAFile verifies the peer; for a server, setting it requires clients to present a certificate
+}
+
+// NewServerTLSConfig creates a TLS config for a server that presents the certificate from [TLSConfig.CertFile],
+// and verifies client certificates against [TLSConfig.CAFile] if it is set.
+//
+// The files are reloaded when they change on disk, so that certificates can be rotated without a restart.
+// If a reload fails, e.g. because only one of the files has been replaced so far, the previous certificate is used.
+func NewServerTLSConfig(c TLSConfig) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("TLS certificate and key files are required")
+	}
+
+	r := &certReloader{files: c}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.get()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"}, // required for GRPC, which only adds it to the outer config
+			}
+			if pool != nil {
+				config.ClientCAs = pool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	}, nil
+}
+
+// NewClientTLSConfig creates a TLS config for a client that verifies the server against [TLSConfig.CAFile],
+// or the system roots if it is not set, and presents the certificate from [TLSConfig.CertFile] if it is set.
+// Like [NewServerTLSConfig], the client certificate is reloaded when it changes.
+func NewClientTLSConfig(c TLSConfig) (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("TLS certificate and key files must be set together")
+	}
+
+	r := &certReloader{files: c}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if _, pool := r.get(); pool != nil {
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.get()
+			return cert, nil
+		}
+	}
+	return config, nil
+}
+
+// certReloader holds the certificate and CA pool loaded from [TLSConfig], reloading them if the files change
+type certReloader struct {
+	files TLSConfig
+
+	mu      sync.Mutex
+	modTime time.Time        // modTime is the latest modification time of the files when they were loaded
+	cert    *tls.Certificate // cert is nil if there is no certificate file
+	pool    *x509.CertPool   // pool is nil if there is no CA file
+}
+
+// get returns the current certificate and CA pool, reloading them first if any of the files has changed
+func (r *certReloader) get() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err == nil && !modTime.Equal(r.modTime) {
+		err = r.load(modTime)
+	}
+	if err != nil {
+		slog.Warn("failed to reload TLS files, using the previous ones", "error", err)
+	}
+	return r.cert, r.pool
+}
+
+// reload loads the files unconditionally
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	return r.load(modTime)
+}
+
+// load reads the files, only replacing the current certificate and pool if they are all valid
+func (r *certReloader) load(modTime time.Time) error {
+	var cert *tls.Certificate
+	if r.files.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		pem, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in TLS CA file %q", r.files.CAFile)
+		}
+	}
+
+	r.cert, r.pool, r.modTime = cert, pool, modTime
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the files
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat TLS file: %w", err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,253 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the tests, without writing the CA key anywhere
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    []byte
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert:   cert,
+		key:    key,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial: 1,
+	}
+}
+
+// issue returns the PEM certificate and key for a leaf certificate, valid for 127.0.0.1
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes the data and sets its modification time, since a rewrite within the
+// resolution of the filesystem timestamps would otherwise not be noticed
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client to a server using the configs, returning the error from each side
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (serverErr, clientErr error) {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, clientErr := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+	if clientErr == nil {
+		// with TLS 1.3 the client can finish before the server has checked its certificate
+		defer conn.Close()
+	}
+	return <-errs, clientErr
+}
+
+// commonName returns the subject common name of the certificate
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	now := time.Now()
+
+	files := map[string][]byte{"ca.pem": ca.pem}
+	files["server.pem"], files["server-key.pem"] = ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	files["client.pem"], files["client-key.pem"] = ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, name), data, now)
+	}
+
+	serverConfig, err := NewServerTLSConfig(TLSConfig{
+		CertFile: filepath.Join(dir, "server.pem"),
+		KeyFile:  filepath.Join(dir, "server-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("client certificate", func(t *testing.T) {
+		clientConfig, err := NewClientTLSConfig(TLSConfig{
+			CertFile: filepath.Join(dir, "client.pem"),
+			KeyFile:  filepath.Join(dir, "client-key.pem"),
+			CAFile:   filepath.Join(dir, "ca.pem"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverErr, clientErr := handshake(t, serverConfig, clientConfig)
+		if serverErr != nil || clientErr != nil {
+			t.Fatalf("handshake failed: server %v, client %v", serverErr, clientErr)
+		}
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		clientConfig, err := NewClientTLSConfig(TLSConfig{
+			CAFile: filepath.Join(dir, "ca.pem"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverErr, _ := handshake(t, serverConfig, clientConfig)
+		if serverErr == nil {
+			t.Fatal("server accepted a client without a certificate")
+		}
+	})
+
+	t.Run("untrusted server", func(t *testing.T) {
+		other := newTestCA(t)
+		writeFile(t, filepath.Join(dir, "other-ca.pem"), other.pem, now)
+		clientConfig, err := NewClientTLSConfig(TLSConfig{
+			CertFile: filepath.Join(dir, "client.pem"),
+			KeyFile:  filepath.Join(dir, "client-key.pem"),
+			CAFile:   filepath.Join(dir, "other-ca.pem"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, clientErr := handshake(t, serverConfig, clientConfig); clientErr == nil {
+			t.Fatal("client accepted a server signed by another CA")
+		}
+	})
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	now := time.Now()
+
+	r := &certReloader{files: TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}}
+
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, r.files.CertFile, certPEM, now)
+	writeFile(t, r.files.KeyFile, keyPEM, now)
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := r.get(); commonName(t, cert) != "first" {
+		t.Fatalf("got certificate %q, want %q", commonName(t, cert), "first")
+	}
+
+	// both files replaced
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, r.files.CertFile, certPEM, now.Add(time.Minute))
+	writeFile(t, r.files.KeyFile, keyPEM, now.Add(time.Minute))
+	if cert, _ := r.get(); commonName(t, cert) != "second" {
+		t.Fatalf("after rewriting the files, got certificate %q, want %q", commonName(t, cert), "second")
+	}
+
+	// only the certificate replaced so far, so it doesn't match the key
+	certPEM, keyPEM = ca.issue(t, "third", x509.ExtKeyUsageServerAuth)
+	writeFile(t, r.files.CertFile, certPEM, now.Add(2*time.Minute))
+	if cert, _ := r.get(); commonName(t, cert) != "second" {
+		t.Fatalf("with a half-written pair, got certificate %q, want the previous %q", commonName(t, cert), "second")
+	}
+
+	// and then the key
+	writeFile(t, r.files.KeyFile, keyPEM, now.Add(3*time.Minute))
+	if cert, _ := r.get(); commonName(t, cert) != "third" {
+		t.Fatalf("after completing the pair, got certificate %q, want %q", commonName(t, cert), "third")
+	}
+}
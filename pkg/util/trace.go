@@ -4,23 +4,48 @@ import (
 	"context"
 	"fmt"
 
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
-// NewTracerProviderForResource creates an OTEL TracerProvider with a default resource
-func NewTracerProviderForResource(ctx context.Context, r *resource.Resource, opts ...otlptracegrpc.Option) (*trace.TracerProvider, error) {
+// NewTracerProviderForResource creates an OTEL TracerProvider with a default resource.
+// Sampling is configured from [Config], see [NewSamplerForConfig] and [NewTailSamplingProcessor].
+func NewTracerProviderForResource(ctx context.Context, r *resource.Resource, c Config, opts ...otlptracegrpc.Option) (*trace.TracerProvider, error) {
+	sampler, err := NewSamplerForConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sampler: %w", err)
+	}
+
 	traceExp, err := otlptracegrpc.New(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create exporter: %w", err)
 	}
 
+	var sp trace.SpanProcessor = trace.NewBatchSpanProcessor(traceExp)
+	if samplesErrors(sampler) {
+		sp = &errorSampledProcessor{next: sp}
+	}
+	if c.TailSampling != nil {
+		sp, err = NewTailSamplingProcessor(sp, *c.TailSampling)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tail sampling processor: %w", err)
+		}
+	}
+
 	tp := trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
-		trace.WithBatcher(traceExp),
+		trace.WithSampler(sampler),
+		trace.WithSpanProcessor(sp),
 		trace.WithResource(r),
 	)
 
 	return tp, nil
 }
+
+// SpanError records the error as an event on the span and sets the span status to error
+func SpanError(span oteltrace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -3,12 +3,15 @@ package util
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
 )
 
 // Config is passed to [SetupDefaultEnvironment] to configure the environment
@@ -17,48 +20,132 @@ type Config struct {
 	ServiceVersion string       // ServiceVersion is applied to the otel resource
 	OTLPEndpoint   string       // OTLPEndpoint is the endpoint for the OTLP exporter
 	LogLevel       slog.Leveler // LogLevel is the log level
+
+	ResourceAttributes []attribute.KeyValue // ResourceAttributes are added to the otel resource, e.g. build details
+
+	MetricsExporter       MetricsExporter // MetricsExporter selects prometheus (pull), otlp (push) or both, defaults to prometheus
+	MetricsProtocol       string          // MetricsProtocol is the OTLP metrics protocol, grpc (default) or http
+	MetricsExportInterval time.Duration   // MetricsExportInterval is how often OTLP metrics are pushed, defaults to 1m
+	MetricsTemporality    string          // MetricsTemporality is the OTLP metrics temporality, cumulative (default) or delta
+	MetricsExemplarFilter string          // MetricsExemplarFilter selects the measurements recorded as exemplars, see [EnableExemplars]
+
+	LogsEndpoint string // LogsEndpoint enables OTLP log export in addition to stdout; host:port for grpc or a URL for http
+	LogsProtocol string // LogsProtocol is the OTLP logs protocol, grpc (default) or http
+
+	TraceSampler      string        // TraceSampler is a standard sampler name such as parentbased_traceidratio, see [NewSamplerForConfig]
+	TraceSamplerArg   string        // TraceSamplerArg is the ratio used by the traceidratio samplers
+	TraceSamplerRules []SamplerRule // TraceSamplerRules override sampling for specific RPC methods
+
+	TailSampling *TailSamplingConfig // TailSampling enables a [TailSamplingProcessor] if not nil
+
+	Propagators    []string // Propagators are the names of the context propagators to use, see [NewPropagatorForConfig]
+	LogBaggageKeys []string // LogBaggageKeys are the baggage members added as attributes by [LoggerFromContext]
 }
 
-// SetupDefaultEnvironment creates and registers components for logging, metrics, and tracing
-func SetupDefaultEnvironment(ctx context.Context, c Config) error {
+// instrumentationName is the instrumentation scope for telemetry created by this package
+const instrumentationName = "github.com/boyvinall/observability-demo/pkg/util"
+
+// otlpHeaders are sent with every OTLP export request
+var otlpHeaders = map[string]string{"x-scope-orgid": "1"}
+
+// ShutdownFunc flushes and releases the components created by [SetupDefaultEnvironment].
+// It should be called once, with a context that bounds how long the flush may take.
+type ShutdownFunc func(ctx context.Context) error
+
+// SetupDefaultEnvironment creates and registers components for logging, metrics, and tracing.
+// The returned [ShutdownFunc] must be called before the process exits, otherwise any
+// buffered telemetry will be lost.
+func SetupDefaultEnvironment(ctx context.Context, c Config) (ShutdownFunc, error) {
+	var shutdownFuncs []ShutdownFunc
+
+	// shutdown calls the registered functions in reverse order, so that components
+	// created last (and possibly depending on earlier ones) are flushed first
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for i := len(shutdownFuncs) - 1; i >= 0; i-- {
+			errs = append(errs, shutdownFuncs[i](ctx))
+		}
+		shutdownFuncs = nil
+		return errors.Join(errs...)
+	}
+
+	// fail cleans up anything already created if setup cannot complete
+	fail := func(err error) (ShutdownFunc, error) {
+		return nil, errors.Join(err, shutdown(ctx))
+	}
 
 	// resource
 
-	r, err := NewDefaultResource(c.ServiceName, c.ServiceVersion)
+	r, err := NewDefaultResource(c.ServiceName, c.ServiceVersion, c.ResourceAttributes...)
 	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+		return fail(fmt.Errorf("failed to create resource: %w", err))
 	}
 
 	// logger
 
-	logger := NewLoggerForResource(r, c.LogLevel)
+	var handlers []slog.Handler
+	if c.LogsEndpoint != "" {
+		lp, err := NewLoggerProviderForResource(ctx, r, c)
+		if err != nil {
+			return fail(fmt.Errorf("failed to create logger provider: %w", err))
+		}
+		shutdownFuncs = append(shutdownFuncs, lp.Shutdown)
+		handlers = append(handlers, NewOTLPHandler(lp.Logger(instrumentationName), c.LogLevel))
+	}
+
+	logger := NewLoggerForResource(r, c.LogLevel, handlers...)
 	slog.SetDefault(logger)
-	otel.SetLogger(LogrFromSlog(logger))
+
+	// the SDK's own logs and errors, including failed exports, only go to stdout,
+	// otherwise each failed OTLP log export would queue another log record
+	stdoutLogger := NewLoggerForResource(r, c.LogLevel)
+	otel.SetLogger(LogrFromSlog(stdoutLogger))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		stdoutLogger.Error("OTEL error", "error", err)
+	}))
 
 	// metrics
 
-	mp, err := NewMeterProviderForResource(r)
+	if err = EnableExemplars(c.MetricsExemplarFilter); err != nil {
+		return fail(err)
+	}
+	readers, err := NewMetricReadersForConfig(ctx, c)
 	if err != nil {
-		return fmt.Errorf("failed to create meter provider: %w", err)
+		return fail(fmt.Errorf("failed to create metric readers: %w", err))
 	}
+	mp, err := NewMeterProviderForResource(r, readers...)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create meter provider: %w", err))
+	}
+	shutdownFuncs = append(shutdownFuncs, mp.Shutdown)
 	otel.SetMeterProvider(mp)
 
+	// GC, memory and goroutine stats, alongside the application metrics
+	if err = runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		return fail(fmt.Errorf("failed to start runtime metrics: %w", err))
+	}
+
 	// traces
 
-	tp, err := NewTracerProviderForResource(ctx, r,
+	tp, err := NewTracerProviderForResource(ctx, r, c,
 		otlptracegrpc.WithEndpoint(c.OTLPEndpoint),
 		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithHeaders(map[string]string{"x-scope-orgid": "1"}),
+		otlptracegrpc.WithHeaders(otlpHeaders),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create tracer provider: %w", err)
+		return fail(fmt.Errorf("failed to create tracer provider: %w", err))
 	}
+	shutdownFuncs = append(shutdownFuncs, tp.Shutdown)
 	otel.SetTracerProvider(tp)
 
-	// TraceContext is used to propagate trace context across process boundaries
+	// propagators carry the trace context and baggage across process boundaries
 
-	tc := propagation.TraceContext{}
-	otel.SetTextMapPropagator(tc)
+	propagator, err := NewPropagatorForConfig(c)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create propagator: %w", err))
+	}
+	otel.SetTextMapPropagator(propagator)
+	SetLogBaggageKeys(c.LogBaggageKeys...)
 
-	return nil
+	return shutdown, nil
 }
@@ -0,0 +1,120 @@
+// Package version describes the build of the running binary.
+//
+// The details can be injected at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/boyvinall/observability-demo/pkg/version.Version=v1.2.3" ./cmd/boomer-server
+//
+// Anything not injected is taken from the module and VCS information embedded by the go toolchain, see [debug.ReadBuildInfo].
+package version
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instrumentationName is the instrumentation scope for telemetry created by this package
+const instrumentationName = "github.com/boyvinall/observability-demo/pkg/version"
+
+// unknown is used for any details that are not available
+const unknown = "unknown"
+
+// Build details, set with -ldflags "-X ..."
+var (
+	Version  string // Version is the release version, e.g. v1.2.3
+	Revision string // Revision is the VCS commit
+	Date     string // Date is when the commit or build was made, preferably RFC3339
+)
+
+// Info describes the build
+type Info struct {
+	Version   string // Version is the release version, or the module version if built with go install
+	Revision  string // Revision is the VCS commit, with a -dirty suffix if there were uncommitted changes
+	Date      string // Date is when the commit or build was made
+	GoVersion string // GoVersion is the version of the go toolchain
+}
+
+// Get returns the build details, preferring those injected with -ldflags
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Revision:  Revision,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+
+		var revision, date string
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				revision = s.Value
+			case "vcs.time":
+				date = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if info.Revision == "" && revision != "" {
+			info.Revision = revision
+			if modified {
+				info.Revision += "-dirty"
+			}
+		}
+		if info.Date == "" {
+			info.Date = date
+		}
+	}
+
+	for _, s := range []*string{&info.Version, &info.Revision, &info.Date} {
+		if *s == "" {
+			*s = unknown
+		}
+	}
+	return info
+}
+
+// String implements the [fmt.Stringer] interface
+func (i Info) String() string {
+	return fmt.Sprintf("%s (revision %s, built %s, %s)", i.Version, i.Revision, i.Date, i.GoVersion)
+}
+
+// ResourceAttributes returns the build details, other than the version, to add to the OTEL resource.
+// The version itself is the service.version resource attribute.
+func (i Info) ResourceAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("service.revision", i.Revision),
+		attribute.String("service.build_date", i.Date),
+	}
+}
+
+// RegisterBuildInfo registers the boomer.build_info gauge, which always has the value 1
+// and describes the build with its attributes, so that it can be joined to other metrics
+func RegisterBuildInfo(mp metric.MeterProvider, i Info) error {
+	attrs := metric.WithAttributes(
+		attribute.String("version", i.Version),
+		attribute.String("revision", i.Revision),
+		attribute.String("build_date", i.Date),
+		attribute.String("goversion", i.GoVersion),
+	)
+
+	_, err := mp.Meter(instrumentationName).Int64ObservableGauge("boomer.build_info",
+		metric.WithDescription("Build details of the running binary"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(1, attrs)
+			return nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to create build_info gauge: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// instrumentationName is the instrumentation scope for telemetry created by this package
+const instrumentationName = "github.com/boyvinall/observability-demo/pkg/worker"
+
+// durationBuckets are the histogram bucket boundaries, in seconds, for processing time and queue lag
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// workerMetrics record how the worker is processing messages
+type workerMetrics struct {
+	received        metric.Int64Counter
+	decodeFailures  metric.Int64Counter
+	respondFailures metric.Int64Counter
+	duration        metric.Float64Histogram
+	queueLag        metric.Float64Histogram
+	inFlight        metric.Int64UpDownCounter
+}
+
+// newWorkerMetrics creates the instruments using the meter
+func newWorkerMetrics(m metric.Meter) (*workerMetrics, error) {
+	wm := &workerMetrics{}
+
+	var err error
+	wm.received, err = m.Int64Counter("boomer.worker.messages.received",
+		metric.WithDescription("Messages received by the worker"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+	wm.decodeFailures, err = m.Int64Counter("boomer.worker.decode.failures",
+		metric.WithDescription("Messages that could not be decoded"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+	wm.respondFailures, err = m.Int64Counter("boomer.worker.respond.failures",
+		metric.WithDescription("Responses that could not be published"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+	wm.duration, err = m.Float64Histogram("boomer.worker.process.duration",
+		metric.WithDescription("Time taken to process each message"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	wm.inFlight, err = m.Int64UpDownCounter("boomer.worker.messages.in_flight",
+		metric.WithDescription("Messages currently being processed"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+	wm.queueLag, err = m.Float64Histogram("boomer.worker.queue.lag",
+		metric.WithDescription("Time between a request being published and received by the worker"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	return wm, nil
+}
+
+// start records a received message and returns a function to call once it has been processed.
+// The queue lag is measured from the publish time in the message headers, or from the published
+// time if there is no header, e.g. the JetStream message metadata.
+func (wm *workerMetrics) start(ctx context.Context, subject string, header nats.Header, published time.Time) func() {
+	attrs := metric.WithAttributes(semconv.MessagingDestinationName(subject))
+	start := time.Now()
+
+	wm.received.Add(ctx, 1, attrs)
+	// without the request context, so that no exemplar is recorded on what prometheus exposes as a gauge
+	wm.inFlight.Add(context.Background(), 1, attrs)
+
+	if t, err := time.Parse(time.RFC3339Nano, header.Get(headerPublished)); err == nil {
+		published = t
+	}
+	if !published.IsZero() {
+		wm.queueLag.Record(ctx, start.Sub(published).Seconds(), attrs)
+	}
+
+	return func() {
+		wm.inFlight.Add(context.Background(), -1, attrs)
+		wm.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}
+}
+
+// decodeFailed records a message that could not be decoded
+func (wm *workerMetrics) decodeFailed(ctx context.Context, subject string) {
+	wm.decodeFailures.Add(ctx, 1, metric.WithAttributes(semconv.MessagingDestinationName(subject)))
+}
+
+// respondFailed records a response that could not be published
+func (wm *workerMetrics) respondFailed(ctx context.Context, subject string) {
+	wm.respondFailures.Add(ctx, 1, metric.WithAttributes(semconv.MessagingDestinationName(subject)))
+}
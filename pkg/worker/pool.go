@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+)
+
+// pool bounds the number of goroutines processing messages from a single subscription.
+//
+// [pool.Go] blocks while the pool is full. Because NATS only delivers the next message once the
+// subscription callback returns, this leaves further messages in the subscription's pending buffer.
+type pool struct {
+	sem  chan struct{}
+	done chan struct{}
+}
+
+// newPool creates a pool that runs at most size functions concurrently
+func newPool(size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+	return &pool{
+		sem:  make(chan struct{}, size),
+		done: make(chan struct{}),
+	}
+}
+
+// Go runs f in a new goroutine once there is space in the pool.
+// It returns false without running f if the pool has been stopped by [pool.Wait].
+func (p *pool) Go(f func()) bool {
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.done:
+		return false
+	}
+
+	go func() {
+		defer func() { <-p.sem }()
+		f()
+	}()
+	return true
+}
+
+// dispatch runs process in the pool, see [natstrace.WithDispatch]
+func (p *pool) dispatch(process func()) {
+	p.Go(process)
+}
+
+// Wait blocks until all running functions have completed, or ctx is done.
+// Once it returns successfully, the pool is stopped and [pool.Go] will not run anything else.
+// It must only be called once.
+func (p *pool) Wait(ctx context.Context) error {
+	for i := 0; i < cap(p.sem); i++ {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	close(p.done)
+	return nil
+}
@@ -3,74 +3,379 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 
 	pb "github.com/boyvinall/observability-demo/pkg/boomer"
-	"github.com/boyvinall/observability-demo/pkg/natscarrier"
+	"github.com/boyvinall/observability-demo/pkg/natstrace"
 	"github.com/boyvinall/observability-demo/pkg/util"
+	"github.com/boyvinall/observability-demo/pkg/workqueue"
 )
 
-// Connection is an interface for subscribing to messages
+const (
+	subjectRequest = "req"        // subjectRequest receives a request and responds once
+	subjectStream  = "req.stream" // subjectStream receives a request and publishes progress to the reply subject
+
+	headerPublished = "Boomer-Published" // headerPublished holds the time a request was published, see [workerMetrics.start]
+
+	streamSteps    = 5                      // streamSteps is the number of progress messages published by [Worker.StreamHandler]
+	streamInterval = 200 * time.Millisecond // streamInterval is the simulated work between progress messages
+)
+
+// Defaults for the worker options
+const (
+	DefaultQueueGroup  = "boomer-workers" // DefaultQueueGroup shares requests between all workers, see [WithQueueGroup]
+	DefaultConcurrency = 10               // DefaultConcurrency is the number of requests processed at once per subscription, see [WithConcurrency]
+
+	drainPollInterval = 50 * time.Millisecond // drainPollInterval is how often [Worker.Drain] checks whether subscriptions have drained
+)
+
+// errNoReply is recorded when a JetStream request has no [workqueue.ReplyHeader]
+var errNoReply = errors.New("request has no reply subject")
+
+// Connection is an interface for subscribing and publishing messages.
+// It is satisfied by [natstrace.Conn], which traces each message.
 type Connection interface {
-	Subscribe(subj string, cb nats.MsgHandler) (*nats.Subscription, error)
+	PublishMsg(ctx context.Context, msg *nats.Msg) error
+	RespondMsg(ctx context.Context, req, resp *nats.Msg) error
+	QueueSubscribe(subj, queue string, h natstrace.MsgHandler, opts ...natstrace.SubscribeOption) (*nats.Subscription, error)
+	Consume(cons jetstream.Consumer, h natstrace.JetStreamHandler, opts ...natstrace.SubscribeOption) (jetstream.ConsumeContext, error)
 }
 
 // Worker processes and responds to requests from a message queue
 type Worker struct {
-	tracer trace.Tracer
-	sub    *nats.Subscription
+	tracer       trace.Tracer
+	c            Connection
+	queueGroup   string
+	concurrency  int
+	pendingMsgs  int
+	pendingBytes int
+	sub          *nats.Subscription
+	streamSub    *nats.Subscription
+	pool         *pool
+	streamPool   *pool
+	consumer     jetstream.Consumer
+	consume      jetstream.ConsumeContext
+	metrics      *workerMetrics
+	stopped      atomic.Bool // stopped is set once the worker stops receiving requests, see [Worker.Ready]
+}
+
+// Option configures optional behaviour of the [Worker]
+type Option func(*Worker)
+
+// WithJetStreamConsumer processes requests from the durable [workqueue] consumer,
+// rather than subscribing to core NATS requests
+func WithJetStreamConsumer(cons jetstream.Consumer) Option {
+	return func(w *Worker) {
+		w.consumer = cons
+	}
+}
+
+// WithQueueGroup sets the NATS queue group, so that each request is delivered to only one
+// of the workers in the group. An empty name delivers every request to every worker.
+func WithQueueGroup(name string) Option {
+	return func(w *Worker) {
+		w.queueGroup = name
+	}
+}
+
+// WithConcurrency sets the maximum number of requests processed at once for each subscription
+func WithConcurrency(n int) Option {
+	return func(w *Worker) {
+		w.concurrency = n
+	}
+}
+
+// WithPendingLimits sets the number of messages and bytes that may be buffered for each subscription
+// while all workers in the pool are busy, see [nats.Subscription.SetPendingLimits].
+// Messages beyond the limits are dropped and reported as a slow consumer.
+func WithPendingLimits(msgs, bytes int) Option {
+	return func(w *Worker) {
+		w.pendingMsgs = msgs
+		w.pendingBytes = bytes
+	}
 }
 
 // New creates a new boomer worker
-func New(c Connection) (*Worker, error) {
+func New(c Connection, opts ...Option) (*Worker, error) {
 	w := &Worker{
-		tracer: otel.Tracer("boomer-worker"),
+		tracer:      otel.Tracer("boomer-worker"),
+		c:           c,
+		queueGroup:  DefaultQueueGroup,
+		concurrency: DefaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
 
 	var err error
-	w.sub, err = c.Subscribe("req", w.Handler)
+	w.metrics, err = newWorkerMetrics(otel.GetMeterProvider().Meter(instrumentationName))
 	if err != nil {
 		return nil, err
 	}
 
+	w.pool = newPool(w.concurrency)
+	w.streamPool = newPool(w.concurrency)
+
+	if w.consumer != nil {
+		w.consume, err = c.Consume(w.consumer, w.JetStreamHandler, natstrace.WithDispatch(w.pool.dispatch))
+	} else {
+		w.sub, err = w.subscribe(subjectRequest, w.pool, w.Handler)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w.streamSub, err = w.subscribe(subjectStream, w.streamPool, w.StreamHandler)
+	if err != nil {
+		w.Stop()
+		return nil, err
+	}
+
 	return w, nil
 }
 
-// Handler processes and responds to the [nats.Msg].
-func (w *Worker) Handler(msg *nats.Msg) {
-	tc := otel.GetTextMapPropagator()
-	ctx := tc.Extract(context.Background(), natscarrier.Header(msg.Header))
+// subscribe creates a queue subscription that processes messages using the pool
+func (w *Worker) subscribe(subj string, p *pool, handler natstrace.MsgHandler) (*nats.Subscription, error) {
+	sub, err := w.c.QueueSubscribe(subj, w.queueGroup, handler, natstrace.WithDispatch(p.dispatch))
+	if err != nil {
+		return nil, err
+	}
+
+	if w.pendingMsgs != 0 || w.pendingBytes != 0 {
+		if err = sub.SetPendingLimits(w.pendingMsgs, w.pendingBytes); err != nil {
+			_ = sub.Unsubscribe()
+			return nil, fmt.Errorf("failed to set pending limits on %s: %w", subj, err)
+		}
+	}
+	return sub, nil
+}
+
+// Ready returns an error if the worker is not receiving requests, because it has been stopped
+// or a subscription has been closed
+func (w *Worker) Ready() error {
+	if w.stopped.Load() {
+		return errors.New("worker is stopped")
+	}
+	for _, sub := range []*nats.Subscription{w.sub, w.streamSub} {
+		if sub != nil && !sub.IsValid() {
+			return fmt.Errorf("subscription %s is closed", sub.Subject)
+		}
+	}
+	return nil
+}
+
+// Stop stops receiving requests, without waiting for in-flight requests to complete
+func (w *Worker) Stop() {
+	w.stopped.Store(true)
+	if w.consume != nil {
+		w.consume.Stop()
+	}
+	if w.sub != nil {
+		_ = w.sub.Unsubscribe()
+	}
+	if w.streamSub != nil {
+		_ = w.streamSub.Unsubscribe()
+	}
+}
+
+// Drain stops receiving requests, processes any that are pending, and waits for in-flight
+// requests to complete. It returns early if ctx is done. Unacknowledged JetStream requests
+// are not processed, they will be redelivered to another worker.
+func (w *Worker) Drain(ctx context.Context) error {
+	w.stopped.Store(true)
+	if w.consume != nil {
+		w.consume.Stop()
+	}
+
+	for _, sub := range []*nats.Subscription{w.sub, w.streamSub} {
+		if sub == nil {
+			continue
+		}
+		if err := sub.Drain(); err != nil {
+			return fmt.Errorf("failed to drain subscription %s: %w", sub.Subject, err)
+		}
+	}
+
+	// the subscriptions become invalid once all pending messages have been passed to the pools
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for (w.sub != nil && w.sub.IsValid()) || w.streamSub.IsValid() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
+	if err := w.pool.Wait(ctx); err != nil {
+		return err
+	}
+	return w.streamPool.Wait(ctx)
+}
+
+// Handler processes and responds to the [nats.Msg].
+func (w *Worker) Handler(ctx context.Context, msg *nats.Msg) error {
 	l := util.LoggerFromContext(ctx)
 	l.Info("received request",
 		"subject", msg.Subject,
 		"reply", msg.Reply,
 	)
 
-	_, span := w.tracer.Start(ctx, "handler")
-	defer span.End()
+	done := w.metrics.start(ctx, msg.Subject, msg.Header, time.Time{})
+	defer done()
+
+	req, err := decode(msg.Data)
+	if err != nil {
+		l.Error("failed to decode request", "error", err)
+		w.metrics.decodeFailed(ctx, msg.Subject)
+		return err
+	}
+
+	b, err := boom(req)
+	if err == nil {
+		resp := nats.NewMsg(msg.Reply)
+		resp.Data = b
+		err = w.c.RespondMsg(ctx, msg, resp)
+	}
+	if err != nil {
+		l.Error("failed to respond", "error", err)
+		w.metrics.respondFailed(ctx, msg.Subject)
+		return err
+	}
+	return nil
+}
+
+// JetStreamHandler processes a [jetstream.Msg] from the work queue, publishing the response to the
+// subject in the [workqueue.ReplyHeader]. Messages that can never succeed are terminated, and
+// failures to respond are redelivered after the consumer's backoff.
+func (w *Worker) JetStreamHandler(ctx context.Context, msg jetstream.Msg) error {
+	reply := msg.Headers().Get(workqueue.ReplyHeader)
+	var delivered uint64
+	var published time.Time
+	if meta, err := msg.Metadata(); err == nil {
+		delivered = meta.NumDelivered
+		published = meta.Timestamp
+	}
+
+	done := w.metrics.start(ctx, msg.Subject(), msg.Headers(), published)
+	defer done()
+
+	l := util.LoggerFromContext(ctx)
+	l.Info("received request",
+		"subject", msg.Subject(),
+		"reply", reply,
+		"delivered", delivered,
+	)
+
+	if reply == "" {
+		l.Error("request has no reply subject")
+		_ = msg.Term()
+		return errNoReply
+	}
 
+	req, err := decode(msg.Data())
+	if err != nil {
+		l.Error("failed to decode request", "error", err)
+		w.metrics.decodeFailed(ctx, msg.Subject())
+		_ = msg.Term()
+		return err
+	}
+
+	b, err := boom(req)
+	if err != nil {
+		l.Error("failed to encode response", "error", err)
+		w.metrics.respondFailed(ctx, msg.Subject())
+		_ = msg.Term()
+		return err
+	}
+
+	respMsg := nats.NewMsg(reply)
+	respMsg.Data = b
+
+	err = w.c.PublishMsg(ctx, respMsg)
+	if err != nil {
+		delay := workqueue.RedeliveryDelay(w.consumer.CachedInfo().Config.BackOff, delivered)
+		w.metrics.respondFailed(ctx, msg.Subject())
+		l.Error("failed to respond", "error", err, "redelivery_delay", delay)
+		_ = msg.NakWithDelay(delay)
+		return err
+	}
+
+	err = msg.Ack()
+	if err != nil {
+		l.Error("failed to ack", "error", err)
+		return err
+	}
+	return nil
+}
+
+// decode decodes a [pb.BoomRequest]
+func decode(data []byte) (*pb.BoomRequest, error) {
 	var req pb.BoomRequest
-	err := proto.Unmarshal(msg.Data, &req)
+	err := proto.Unmarshal(data, &req)
 	if err != nil {
-		_ = msg.Nak()
-		return
+		return nil, err
 	}
+	return &req, nil
+}
 
+// boom processes the request, returning the encoded [pb.BoomResponse]
+func boom(_ *pb.BoomRequest) ([]byte, error) {
 	resp := &pb.BoomResponse{Message: "Boom!"}
-	b, err := proto.Marshal(resp)
+	return proto.Marshal(resp)
+}
+
+// StreamHandler processes a [nats.Msg] that expects a stream of progress messages,
+// publishing each one to the reply subject as the simulated work proceeds.
+func (w *Worker) StreamHandler(ctx context.Context, msg *nats.Msg) error {
+	l := util.LoggerFromContext(ctx)
+	l.Info("received stream request",
+		"subject", msg.Subject,
+		"reply", msg.Reply,
+	)
+
+	done := w.metrics.start(ctx, msg.Subject, msg.Header, time.Time{})
+	defer done()
+
+	req, err := decode(msg.Data)
 	if err != nil {
-		_ = msg.Nak()
-		return
+		l.Error("failed to decode request", "error", err)
+		w.metrics.decodeFailed(ctx, msg.Subject)
+		return err
 	}
 
-	err = msg.Respond(b)
-	if err != nil {
-		_ = msg.Nak()
-		return
+	span := trace.SpanFromContext(ctx)
+
+	for step := 1; step <= streamSteps; step++ {
+		time.Sleep(streamInterval)
+
+		progress := &pb.BoomProgress{
+			Message: fmt.Sprintf("Boom %d/%d for %s", step, streamSteps, req.GetName()),
+			Step:    int32(step),
+			Total:   streamSteps,
+		}
+		b, err := proto.Marshal(progress)
+		if err == nil {
+			respMsg := nats.NewMsg(msg.Reply)
+			respMsg.Data = b
+			err = w.c.RespondMsg(ctx, msg, respMsg)
+		}
+		if err != nil {
+			l.Error("failed to respond", "error", err, "step", step)
+			w.metrics.respondFailed(ctx, msg.Subject)
+			return err
+		}
+		span.AddEvent("progress", trace.WithAttributes(attribute.Int("step", step)))
 	}
+	return nil
 }
@@ -0,0 +1,84 @@
+// Package workqueue defines the JetStream stream and consumer used as a durable work queue
+// between the boomer server and workers.
+//
+// The server publishes each request to [Subject], with the subject on which it is waiting for
+// the response set in the [ReplyHeader]. Requests are persisted in the stream until a worker
+// acknowledges them, so work survives worker restarts.
+package workqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	StreamName  = "BOOMER"          // StreamName is the name of the JetStream stream
+	Subject     = "boomer.work"     // Subject is where requests are published
+	ReplyHeader = "Boomer-Reply-To" // ReplyHeader holds the subject that the response should be published to
+)
+
+// DefaultMaxAge matches the default request timeout of the server, after which nobody is waiting for the response
+const DefaultMaxAge = 10 * time.Second
+
+// ConsumerConfig configures the durable pull consumer created by [EnsureConsumer]
+type ConsumerConfig struct {
+	Durable    string          // Durable is the consumer name, shared by all workers
+	AckWait    time.Duration   // AckWait is how long to wait for an ack before redelivering, ignored if BackOff is set
+	MaxDeliver int             // MaxDeliver is the maximum number of delivery attempts for each message
+	BackOff    []time.Duration // BackOff are the redelivery delays for each successive attempt
+}
+
+// EnsureStream creates the work queue stream, or updates it to match the expected config.
+// Requests are discarded once they are older than maxAge, which should be at least the server's request timeout,
+// so that a backlog that built up while no worker was running is not processed long after the server gave up.
+func EnsureStream(ctx context.Context, js jetstream.JetStream, maxAge time.Duration) (jetstream.Stream, error) {
+	s, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      StreamName,
+		Subjects:  []string{Subject},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+		MaxAge:    maxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream %s: %w", StreamName, err)
+	}
+	return s, nil
+}
+
+// EnsureConsumer creates the durable pull consumer on the work queue stream, or updates it to match the config
+func EnsureConsumer(ctx context.Context, js jetstream.JetStream, c ConsumerConfig) (jetstream.Consumer, error) {
+	if len(c.BackOff) > 0 && c.MaxDeliver > 0 && c.MaxDeliver <= len(c.BackOff) {
+		return nil, fmt.Errorf("max deliver (%d) must be greater than the number of backoff durations (%d)", c.MaxDeliver, len(c.BackOff))
+	}
+
+	cons, err := js.CreateOrUpdateConsumer(ctx, StreamName, jetstream.ConsumerConfig{
+		Durable:       c.Durable,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.AckWait,
+		MaxDeliver:    c.MaxDeliver,
+		BackOff:       c.BackOff,
+		FilterSubject: Subject,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer %s: %w", c.Durable, err)
+	}
+	return cons, nil
+}
+
+// RedeliveryDelay returns the delay before the next delivery attempt, given the number of attempts so far.
+// The last backoff duration is used for any attempts beyond the end of the list.
+func RedeliveryDelay(backoff []time.Duration, delivered uint64) time.Duration {
+	if len(backoff) == 0 {
+		return 0
+	}
+	if delivered == 0 {
+		delivered = 1
+	}
+	if i := delivered - 1; i < uint64(len(backoff)) {
+		return backoff[i]
+	}
+	return backoff[len(backoff)-1]
+}